@@ -1,21 +1,111 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
-	"github.com/namely/k8s-pipeliner/pipeline"
 	"github.com/namely/k8s-pipeliner/pipeline/builder"
 	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/namely/k8s-pipeliner/pipeline/diff"
+	"github.com/namely/k8s-pipeliner/pipeline/gate"
+	"github.com/namely/k8s-pipeliner/pipeline/importer"
+	"github.com/namely/k8s-pipeliner/pipeline/remote"
+	"github.com/namely/k8s-pipeliner/pipeline/schema"
+	"github.com/namely/k8s-pipeliner/pipeline/validation"
 	"github.com/urfave/cli"
 )
 
 var (
 	// Version defines the current version of k8s-pipeliner
 	version = "n/a"
+
+	// builderFlags are shared by every command that builds a pipeline
+	builderFlags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "linear, l",
+			Usage: "Assigns refs and reliesOn identifiers for you so you dont need to specify them. This is useful if your pipelines are always linear.",
+		},
+		cli.IntFlag{
+			Name:  "timeout",
+			Usage: "override the default 72 hour timeout (unit: int)",
+		},
+		cli.StringSliceFlag{
+			Name:  "override",
+			Usage: "override an environment with a different environment (example --override=int-k8s:int), --override=<old env>:<new env>, must be separated by colon",
+		},
+		cli.BoolFlag{
+			Name:  "hybrid",
+			Usage: "resolves symbolic refIds and makes stages without reliesOn depend on the previous stage",
+		},
+		cli.StringFlag{
+			Name:  "pipeline-id",
+			Usage: "sets the id of the generated pipeline, overriding the id in the pipeline file",
+		},
+		cli.BoolFlag{
+			Name:  "deterministic-id",
+			Usage: "derives a stable pipeline id from the application and pipeline name when no id is given",
+		},
+		cli.StringFlag{
+			Name:  "base-path",
+			Usage: "resolves the relative paths of the pipeline file against this directory instead of the directory of the pipeline file",
+		},
+		cli.StringFlag{
+			Name:  "root-path",
+			Usage: "fails for paths of the pipeline file outside of this directory, defaults to the git repository of the base path",
+		},
+		cli.BoolFlag{
+			Name:  "offline",
+			Usage: "only uses cached remote manifests that are pinned in the lockfile of the pipeline",
+		},
+		cli.BoolFlag{
+			Name:  "update-lock",
+			Usage: "fetches every remote manifest again and pins it in the lockfile of the pipeline, the only mode that writes the lockfile",
+		},
+		cli.StringFlag{
+			Name:  "cache-dir",
+			Usage: "stores fetched remote manifests in this directory instead of the user cache directory",
+		},
+		cli.StringSliceFlag{
+			Name:  "var",
+			Usage: "overrides a var of the pipeline file and its includes (example --var=service=nginx), --var=<name>=<value>",
+		},
+	}
+
+	// strictFlag enables strict decoding of the pipeline file, validate enables it by default
+	strictFlag = cli.BoolFlag{
+		Name:  "strict",
+		Usage: "fails on unknown or duplicate keys in the pipeline file instead of ignoring them",
+	}
+
+	// gateFlags are shared by every command that talks to the Gate API
+	gateFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "gate-url",
+			Usage:  "address of the Spinnaker Gate API (example https://gate.example.com)",
+			EnvVar: "GATE_URL",
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "bearer token used to authenticate with Gate",
+			EnvVar: "GATE_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "cert",
+			Usage:  "client certificate file used to authenticate with Gate (requires --key)",
+			EnvVar: "GATE_CLIENT_CERT",
+		},
+		cli.StringFlag{
+			Name:   "key",
+			Usage:  "client certificate key file used to authenticate with Gate (requires --cert)",
+			EnvVar: "GATE_CLIENT_KEY",
+		},
+	}
 )
 
 func main() {
@@ -30,25 +120,68 @@ func main() {
 			Name:   "create",
 			Usage:  "creates a spinnaker pipeline for a given application on multiple k8s clusters",
 			Action: createAction,
-			Flags: []cli.Flag{
+			Flags:  append([]cli.Flag{strictFlag}, builderFlags...),
+		},
+		{
+			Name:   "publish",
+			Usage:  "creates or updates a spinnaker pipeline through the Gate API",
+			Action: publishAction,
+			Flags: append(append([]cli.Flag{
 				cli.BoolFlag{
-					Name:  "linear, l",
-					Usage: "Assigns refs and reliesOn identifiers for you so you dont need to specify them. This is useful if your pipelines are always linear.",
+					Name:  "dry-run",
+					Usage: "prints the pipeline JSON that would be saved instead of saving it",
 				},
-				cli.IntFlag{
-					Name:  "timeout",
-					Usage: "override the default 72 hour timeout (unit: int)",
+				strictFlag,
+			}, gateFlags...), builderFlags...),
+		},
+		{
+			Name:   "diff",
+			Usage:  "shows the stages and manifests that differ between a generated pipeline and a deployed pipeline",
+			Action: diffAction,
+			Flags: append(append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "reference, r",
+					Usage: "pipeline JSON file to compare against, the pipeline is fetched from Gate when omitted",
+				},
+				cli.BoolFlag{
+					Name:  "exit-code",
+					Usage: "exit with a non-zero status when the pipelines differ",
+				},
+				strictFlag,
+			}, gateFlags...), builderFlags...),
+		},
+		{
+			Name:   "import",
+			Usage:  "generates a pipeline.yml and manifest files from an existing spinnaker pipeline JSON file",
+			Action: importAction,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "output, o",
+					Value: "pipeline.yml",
+					Usage: "path of the generated pipeline file, manifests are written relative to it",
 				},
-				cli.StringSliceFlag{
-					Name:  "override",
-					Usage: "override an environment with a different environment (example --override=int-k8s:int), --override=<old env>:<new env>, must be separated by colon",
+				cli.StringFlag{
+					Name:  "manifest-dir",
+					Value: "manifests",
+					Usage: "directory (relative to the pipeline file) that embedded manifests are extracted into",
 				},
 			},
 		},
+		{
+			Name:   "schema",
+			Usage:  "prints the JSON Schema of pipeline.yml files for this version of k8s-pipeliner",
+			Action: schemaAction,
+		},
 		{
 			Name:   "validate",
-			Usage:  "performs simple validation on a pipeline to ensure it will work with Spinnaker + Kubernetes",
+			Usage:  "runs the validation rules against a pipeline to ensure it will work with Spinnaker + Kubernetes",
 			Action: validateAction,
+			Flags: append([]cli.Flag{
+				cli.BoolTFlag{
+					Name:  "strict",
+					Usage: "fails on unknown or duplicate keys in the pipeline file, enabled by default",
+				},
+			}, builderFlags...),
 		},
 	}
 
@@ -59,45 +192,349 @@ func main() {
 }
 
 func createAction(ctx *cli.Context) error {
-	pipelineFile := ctx.Args().First()
-	if pipelineFile == "" {
+	project, err := projectHelper(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts, err := builderOptions(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	p, err := pipelineConfigHelper(ctx, builder.NewFileReader(opts...))
+	if err != nil {
+		return err
+	}
+
+	builder := builder.New(p, opts...)
+
+	return json.NewEncoder(os.Stdout).Encode(builder)
+}
+
+func publishAction(ctx *cli.Context) error {
+	project, err := projectHelper(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts, err := builderOptions(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	p, err := pipelineConfigHelper(ctx, builder.NewFileReader(opts...))
+	if err != nil {
+		return err
+	}
+
+	b := builder.New(p, opts...)
+	sp, err := b.Pipeline()
+	if err != nil {
+		return err
+	}
+
+	// a derived id can't match a pipeline created in the UI, it is replaced by the saved one
+	client, err := gateClient(ctx, gate.WithAdoptSavedID(b.IsIDDerived()))
+	if err != nil {
+		return err
+	}
+
+	if ctx.Bool("dry-run") {
+		if err := client.ResolvePipelineID(sp); err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sp)
+	}
+
+	if err := client.UpsertPipeline(sp); err != nil {
+		return err
+	}
+
+	fmt.Printf("published pipeline %q for application %q\n", sp.Name, sp.Application)
+	return nil
+}
+
+func diffAction(ctx *cli.Context) error {
+	project, err := projectHelper(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts, err := builderOptions(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	p, err := pipelineConfigHelper(ctx, builder.NewFileReader(opts...))
+	if err != nil {
+		return err
+	}
+
+	sp, err := builder.New(p, opts...).Pipeline()
+	if err != nil {
+		return err
+	}
+
+	generated, err := diff.Normalize(sp)
+	if err != nil {
+		return err
+	}
+
+	var reference map[string]interface{}
+	if refFile := ctx.String("reference"); refFile != "" {
+		content, err := ioutil.ReadFile(refFile)
+		if err != nil {
+			return err
+		}
+
+		reference, err = diff.Parse(content)
+		if err != nil {
+			return err
+		}
+	} else {
+		client, err := gateClient(ctx)
+		if err != nil {
+			return err
+		}
+
+		reference, err = client.PipelineConfig(p.Application, p.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// pipeline ids are assigned by spinnaker, so only compare them when the
+	// generated pipeline has one of its own
+	if sp.ID == "" {
+		delete(reference, "id")
+	}
+
+	report := diff.Compare(generated, reference)
+	if err := report.Write(os.Stdout); err != nil {
+		return err
+	}
+
+	if ctx.Bool("exit-code") && !report.Empty() {
+		return cli.NewExitError("", 1)
+	}
+
+	return nil
+}
+
+func schemaAction(ctx *cli.Context) error {
+	out, err := json.MarshalIndent(schema.Generate(version), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+	return nil
+}
+
+func importAction(ctx *cli.Context) error {
+	pipelineJSON := ctx.Args().First()
+	if pipelineJSON == "" {
 		return errors.New("missing parameter: file")
 	}
 
-	f, err := os.Open(pipelineFile)
+	content, err := ioutil.ReadFile(pipelineJSON)
 	if err != nil {
 		return err
 	}
 
-	p, err := config.NewPipeline(f)
+	result, err := importer.New(ctx.String("manifest-dir")).Import(content)
 	if err != nil {
 		return err
 	}
 
+	out, err := result.MarshalPipeline()
+	if err != nil {
+		return err
+	}
+
+	pipelineFile := ctx.String("output")
+	baseDir := filepath.Dir(pipelineFile)
+	for file, manifest := range result.Manifests {
+		dest := filepath.Join(baseDir, file)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dest, manifest, 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := ioutil.WriteFile(pipelineFile, out, 0644); err != nil {
+		return err
+	}
+
+	for _, u := range result.Unsupported {
+		fmt.Fprintf(os.Stderr, "warning: could not translate %s\n", u)
+	}
+
+	return nil
+}
+
+func builderOptions(ctx *cli.Context, project *config.Project) ([]builder.OptFunc, error) {
 	overrideEnvs := map[string]string{}
 	for _, newEnv := range ctx.StringSlice("override") {
 		mapping := strings.Split(newEnv, ":")
 		if len(mapping) != 2 {
-			return fmt.Errorf("environment override flag was not formatted correctly")
+			return nil, fmt.Errorf("environment override flag was not formatted correctly")
 		}
 		overrideEnvs[mapping[0]] = mapping[1]
 	}
 
-	builder := builder.New(p, builder.WithLinear(ctx.Bool("linear")), builder.WithTimeoutOverride(ctx.Int("timeout")), builder.WithAccountOverride(overrideEnvs))
+	basePath := ctx.String("base-path")
+	if basePath == "" {
+		basePath = filepath.Dir(ctx.Args().First())
+	}
 
-	return json.NewEncoder(os.Stdout).Encode(builder)
+	rootPath := ctx.String("root-path")
+	if rootPath == "" {
+		var err error
+		if rootPath, err = repositoryRoot(basePath); err != nil {
+			return nil, err
+		}
+	}
+
+	fetcher, err := remoteFetcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []builder.OptFunc{
+		builder.WithBasePath(basePath),
+		builder.WithRootPath(rootPath),
+		builder.WithRemote(fetcher),
+		builder.WithLinear(ctx.Bool("linear")),
+		builder.WithHybrid(ctx.Bool("hybrid")),
+		builder.WithTimeoutOverride(ctx.Int("timeout")),
+		builder.WithAccountOverride(overrideEnvs),
+		builder.WithPipelineID(ctx.String("pipeline-id")),
+		builder.WithDeterministicID(ctx.Bool("deterministic-id")),
+		builder.WithWorkloads(project.Workloads...),
+	}
+	if project.Environments != nil {
+		opts = append(opts, builder.WithEnvironmentMap(*project.Environments))
+	}
+
+	return opts, nil
+}
+
+// remoteFetcher fetches remote manifests through the cache, pinned by the
+// lockfile next to the pipeline file, ie: pipeline.lock.yml for pipeline.yml
+func remoteFetcher(ctx *cli.Context) (*remote.Fetcher, error) {
+	cacheDir := ctx.String("cache-dir")
+	if cacheDir == "" {
+		cacheDir = remote.DefaultCacheDir()
+	}
+
+	pipelineFile := ctx.Args().First()
+	ext := filepath.Ext(pipelineFile)
+	lock, err := remote.LoadLockfile(strings.TrimSuffix(pipelineFile, ext) + ".lock" + ext)
+	if err != nil {
+		return nil, err
+	}
+
+	return remote.NewFetcher(
+		remote.WithCache(remote.NewCache(cacheDir)),
+		remote.WithLockfile(lock),
+		remote.WithOffline(ctx.Bool("offline")),
+		remote.WithUpdateLock(ctx.Bool("update-lock")),
+	), nil
+}
+
+// repositoryRoot returns the closest directory from dir up that contains a
+// .git entry, or an empty root that doesn't restrict paths outside of a git
+// repository, ie: in builds that exclude .git
+func repositoryRoot(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for current := abs; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current, nil
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", nil
+		}
+		current = parent
+	}
+}
+
+// projectHelper loads the project config that applies to the pipeline file
+func projectHelper(ctx *cli.Context) (*config.Project, error) {
+	return config.LoadProject(filepath.Dir(ctx.Args().First()))
+}
+
+func gateClient(ctx *cli.Context, opts ...gate.OptFunc) (*gate.Client, error) {
+	gateURL := ctx.String("gate-url")
+	if gateURL == "" {
+		return nil, errors.New("missing flag: --gate-url")
+	}
+
+	if token := ctx.String("token"); token != "" {
+		opts = append(opts, gate.WithBearerToken(token))
+	}
+
+	certFile, keyFile := ctx.String("cert"), ctx.String("key")
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("--cert and --key must be provided together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gate.WithClientCertificate(cert))
+	}
+
+	return gate.NewClient(gateURL, opts...)
 }
 
 func validateAction(ctx *cli.Context) error {
-	p, err := pipelineConfigHelper(ctx)
+	project, err := projectHelper(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts, err := builderOptions(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	p, err := pipelineConfigHelper(ctx, builder.NewFileReader(opts...))
 	if err != nil {
 		return err
 	}
 
-	return pipeline.NewValidator(p).Validate()
+	v := validation.New(validation.WithProject(project), validation.WithBuilderOptions(opts...))
+	results, err := v.Validate(p)
+	if err != nil {
+		return err
+	}
+
+	if err := results.Write(os.Stdout); err != nil {
+		return err
+	}
+
+	if n := results.Count(validation.SeverityError); n > 0 {
+		return cli.NewExitError(fmt.Sprintf("validation failed with %d error(s)", n), 1)
+	}
+
+	return nil
 }
 
-func pipelineConfigHelper(ctx *cli.Context) (*config.Pipeline, error) {
+func pipelineConfigHelper(ctx *cli.Context, files config.FileReader) (*config.Pipeline, error) {
 	pipelineFile := ctx.Args().First()
 	if pipelineFile == "" {
 		return nil, errors.New("missing parameter: file")
@@ -108,7 +545,16 @@ func pipelineConfigHelper(ctx *cli.Context) (*config.Pipeline, error) {
 		return nil, err
 	}
 
-	p, err := config.NewPipeline(f)
+	vars := map[string]string{}
+	for _, v := range ctx.StringSlice("var") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("var flag was not formatted correctly")
+		}
+		vars[kv[0]] = kv[1]
+	}
+
+	p, err := config.NewPipeline(f, config.WithStrict(ctx.Bool("strict")), config.WithFilename(pipelineFile), config.WithVars(vars), config.WithFiles(files))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,175 @@
+package builder
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+const (
+	// DockerImageArtifact is the spinnaker artifact type of docker images
+	DockerImageArtifact = "docker/image"
+)
+
+var (
+	// ErrUnknownArtifactType is returned when an expected artifact uses a type spinnaker does not support
+	ErrUnknownArtifactType = errors.New("builder: unknown artifact type")
+	// ErrDuplicateArtifactID is returned when two expected artifacts use the same id
+	ErrDuplicateArtifactID = errors.New("builder: expected artifact id is used more than once")
+	// ErrUnknownArtifactID is returned when a trigger or stage references an expected artifact that is not declared
+	ErrUnknownArtifactID = errors.New("builder: unknown expected artifact id")
+	// ErrManifestArtifactWithFiles is returned when a manifest stage deploys an artifact and manifest files
+	ErrManifestArtifactWithFiles = errors.New("builder: a manifest stage can not deploy a manifest artifact and manifest files")
+	// ErrNotManifestArtifact is returned when a docker image is referenced as the manifest of a stage
+	ErrNotManifestArtifact = errors.New("builder: docker image artifacts can not be deployed as a manifest")
+
+	artifactTypes = map[string]bool{
+		DockerImageArtifact: true,
+		"github/file":       true,
+		"gitlab/file":       true,
+		"s3/object":         true,
+		"http/file":         true,
+		"helm/chart":        true,
+		"git/repo":          true,
+	}
+)
+
+// buildExpectedArtifacts converts the expected artifacts of the pipeline config
+func buildExpectedArtifacts(artifacts []config.ExpectedArtifact) ([]types.ExpectedArtifact, error) {
+	var built []types.ExpectedArtifact
+	seen := make(map[string]bool)
+	for _, ea := range artifacts {
+		if seen[ea.ID] {
+			return nil, errors.Wrap(ErrDuplicateArtifactID, ea.ID)
+		}
+		seen[ea.ID] = true
+
+		match, err := buildArtifact(ea.Match)
+		if err != nil {
+			return nil, errors.Wrapf(err, "expected artifact %s", ea.ID)
+		}
+
+		artifact := types.ExpectedArtifact{
+			ID:               ea.ID,
+			DisplayName:      ea.DisplayName,
+			MatchArtifact:    *match,
+			UsePriorArtifact: ea.UsePriorArtifact,
+		}
+
+		if ea.Default != nil {
+			artifact.DefaultArtifact, err = buildArtifact(*ea.Default)
+			if err != nil {
+				return nil, errors.Wrapf(err, "expected artifact %s", ea.ID)
+			}
+			artifact.UseDefaultArtifact = true
+		}
+
+		built = append(built, artifact)
+	}
+
+	return built, nil
+}
+
+// IsArtifactType reports whether expected artifacts can use the given artifact type
+func IsArtifactType(t string) bool {
+	return artifactTypes[t]
+}
+
+func buildArtifact(a config.Artifact) (*types.Artifact, error) {
+	if !artifactTypes[a.Type] {
+		return nil, errors.Wrap(ErrUnknownArtifactType, a.Type)
+	}
+
+	return &types.Artifact{
+		ArtifactAccount: a.Account,
+		Type:            a.Type,
+		Name:            a.Name,
+		Reference:       a.Reference,
+		Version:         a.Version,
+	}, nil
+}
+
+// expectedArtifact returns the expected artifact of the pipeline with the given id
+func (b *Builder) expectedArtifact(id string) (config.ExpectedArtifact, error) {
+	for _, ea := range b.pipeline.ExpectedArtifacts {
+		if ea.ID == id {
+			return ea, nil
+		}
+	}
+
+	return config.ExpectedArtifact{}, errors.Wrap(ErrUnknownArtifactID, id)
+}
+
+// checkArtifactIDs returns an error for the first id that is not an expected artifact of the pipeline
+func (b *Builder) checkArtifactIDs(ids []string) error {
+	for _, id := range ids {
+		if _, err := b.expectedArtifact(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// triggerArtifactIDs returns the expected artifacts a trigger is bound to
+func triggerArtifactIDs(t config.Trigger) []string {
+	var ids []string
+	if t.Jenkins != nil {
+		ids = append(ids, t.Jenkins.ExpectedArtifactIDs...)
+	}
+	if t.Webhook != nil {
+		ids = append(ids, t.Webhook.ExpectedArtifactIDs...)
+	}
+	if t.Docker != nil {
+		ids = append(ids, t.Docker.ExpectedArtifactIDs...)
+	}
+	if t.Git != nil {
+		ids = append(ids, t.Git.ExpectedArtifactIDs...)
+	}
+	if t.Cron != nil {
+		ids = append(ids, t.Cron.ExpectedArtifactIDs...)
+	}
+	if t.Pipeline != nil {
+		ids = append(ids, t.Pipeline.ExpectedArtifactIDs...)
+	}
+	if t.PubSub != nil {
+		ids = append(ids, t.PubSub.ExpectedArtifactIDs...)
+	}
+
+	return ids
+}
+
+// manifestArtifact points a manifest stage at the manifest of an expected
+// artifact or of a bake, spinnaker fetches it with the account of the artifact
+func (b *Builder) manifestArtifact(stage *types.ManifestStage, id string) error {
+	stage.Source = "artifact"
+	stage.ManifestArtifactID = id
+
+	if b.baked[id] {
+		stage.ManifestArtifactAccount = embeddedArtifactAccount
+		return nil
+	}
+
+	ea, err := b.expectedArtifact(id)
+	if err != nil {
+		return err
+	}
+
+	if ea.Match.Type == DockerImageArtifact {
+		return errors.Wrap(ErrNotManifestArtifact, id)
+	}
+
+	stage.ManifestArtifactAccount = artifactAccount(ea)
+
+	return nil
+}
+
+// artifactAccount returns the account of the match artifact, or else of the default artifact
+func artifactAccount(ea config.ExpectedArtifact) string {
+	if ea.Match.Account == "" && ea.Default != nil {
+		return ea.Default.Account
+	}
+
+	return ea.Match.Account
+}
@@ -0,0 +1,117 @@
+package builder
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+var (
+	// ErrUnknownTemplateRenderer is returned when a bake uses a template renderer spinnaker does not support
+	ErrUnknownTemplateRenderer = errors.New("builder: unknown template renderer")
+	// ErrNoBakeOutputName is returned when a bake manifest stage does not name its output
+	ErrNoBakeOutputName = errors.New("builder: bake manifest stages need an outputName")
+	// ErrKustomizeBake is returned when a kustomize bake does not have a single input artifact and a kustomization path
+	ErrKustomizeBake = errors.New("builder: kustomize bakes need exactly one input artifact and a kustomizeFilePath")
+
+	bakeRenderers = map[string]bool{"HELM2": true, "HELM3": true, "KUSTOMIZE": true, "KUSTOMIZE4": true}
+)
+
+// buildBakeManifestStage renders the input artifacts of the stage inside spinnaker
+func (b *Builder) buildBakeManifestStage(index int, s config.Stage) (*types.BakeManifestStage, error) {
+	bm := s.BakeManifest
+	if !bakeRenderers[bm.TemplateRenderer] {
+		return nil, errors.Wrap(ErrUnknownTemplateRenderer, bm.TemplateRenderer)
+	}
+	if bm.OutputName == "" {
+		return nil, ErrNoBakeOutputName
+	}
+
+	var inputs []types.InputArtifact
+	for _, in := range bm.InputArtifacts {
+		ea, err := b.expectedArtifact(in.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		account := in.Account
+		if account == "" {
+			account = artifactAccount(ea)
+		}
+		inputs = append(inputs, types.InputArtifact{Account: account, ID: in.ID})
+	}
+
+	overrides := bm.Overrides
+	if overrides == nil {
+		overrides = map[string]string{}
+	}
+
+	stage := &types.BakeManifestStage{
+		StageMetadata:     buildStageMetadata(s, "bakeManifest", index, b.isLinear),
+		TemplateRenderer:  bm.TemplateRenderer,
+		OutputName:        bm.OutputName,
+		Namespace:         bm.Namespace,
+		Overrides:         overrides,
+		ExpectedArtifacts: []types.ExpectedArtifact{bakedArtifact(bm.OutputName)},
+	}
+
+	// kustomize renders a single artifact, helm renders the first input
+	// artifact as the chart and the others as values files
+	switch bm.TemplateRenderer {
+	case "KUSTOMIZE", "KUSTOMIZE4":
+		if len(inputs) != 1 || bm.KustomizeFilePath == "" {
+			return nil, ErrKustomizeBake
+		}
+		stage.InputArtifact = &inputs[0]
+		stage.KustomizeFilePath = bm.KustomizeFilePath
+	default:
+		stage.InputArtifacts = inputs
+	}
+
+	return stage, nil
+}
+
+// bakedArtifact is the manifest a bake produces, later stages deploy it by its name
+func bakedArtifact(name string) types.ExpectedArtifact {
+	return types.ExpectedArtifact{
+		ID:            name,
+		DisplayName:   name,
+		MatchArtifact: types.Artifact{Type: EmbeddedArtifact, Name: name},
+	}
+}
+
+// bakeOutputs returns the names of the manifests the stages bake, they share
+// the ids of the expected artifacts of the pipeline
+func (b *Builder) bakeOutputs(stages []config.Stage) (map[string]bool, error) {
+	outputs := make(map[string]bool)
+	for _, ea := range b.pipeline.ExpectedArtifacts {
+		outputs[ea.ID] = false
+	}
+
+	for _, s := range stages {
+		var name string
+		switch {
+		case s.BakeManifest != nil:
+			name = s.BakeManifest.OutputName
+		case s.DeployEmbeddedManifests != nil && s.DeployEmbeddedManifests.BakesHelmChart() && len(s.DeployEmbeddedManifests.HelmCharts) == 1:
+			name = s.DeployEmbeddedManifests.HelmCharts[0].ReleaseName
+		}
+		if name == "" {
+			continue
+		}
+
+		if _, ok := outputs[name]; ok {
+			return nil, errors.Wrapf(ErrDuplicateArtifactID, "%s is baked by stage %s", name, s.Name)
+		}
+		outputs[name] = true
+	}
+
+	for id, baked := range outputs {
+		if !baked {
+			delete(outputs, id)
+		}
+	}
+
+	return outputs, nil
+}
@@ -2,20 +2,19 @@
 package builder
 
 import (
+	"bytes"
+	"crypto/sha1"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path"
+	"io/fs"
+	"strings"
 
 	cnfgrtr "github.com/namely/k8s-configurator"
 	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
 	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/namely/k8s-pipeliner/pipeline/remote"
 	"github.com/pkg/errors"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 const (
@@ -39,18 +38,13 @@ var (
 	ErrNoNamespace = errors.New("builder: manifest does not have a namespace defined")
 	// ErrNoKubernetesMetadata is returned when a manifest does not have kubernetes metadata
 	ErrNoKubernetesMetadata = errors.New("builder: manifest does not have kubernetes metadata attached")
+	// ErrNoStageType is returned when a stage in the pipeline.yml does not define a stage type
+	ErrNoStageType = errors.New("builder: stage does not define a stage type")
+	// ErrMultipleStageTypes is returned when a stage in the pipeline.yml defines more than one stage type
+	ErrMultipleStageTypes = errors.New("builder: stage defines more than one stage type")
 
-	// Stages helps to translate from spinnaker account to configurator stages
-	Stages = map[string]string{
-		"int":            "int",
-		"int-k8s":        "int",
-		"staging":        "stage",
-		"staging-k8s":    "stage",
-		"production":     "production",
-		"production-k8s": "production",
-		"ops":            "ops",
-		"ops-k8s":        "ops",
-	}
+	// pipelineIDNamespace is the UUID namespace used for deterministic pipeline IDs
+	pipelineIDNamespace = [16]byte{0x5e, 0x3c, 0x1b, 0x2a, 0x8f, 0x4d, 0x4e, 0x61, 0x9a, 0x07, 0x6c, 0x2f, 0xd1, 0x8b, 0x43, 0x90}
 )
 
 const (
@@ -58,6 +52,16 @@ const (
 	JenkinsTrigger = "jenkins"
 	// WebhookTrigger is the name of the type in the spinnaker json for pipeline config for webhooks
 	WebhookTrigger = "webhook"
+	// DockerTrigger is the name of the type in the spinnaker json for pipeline config for docker registry triggers
+	DockerTrigger = "docker"
+	// GitTrigger is the name of the type in the spinnaker json for pipeline config for git push triggers
+	GitTrigger = "git"
+	// CronTrigger is the name of the type in the spinnaker json for pipeline config for scheduled triggers
+	CronTrigger = "cron"
+	// PipelineTrigger is the name of the type in the spinnaker json for pipeline config for upstream pipeline triggers
+	PipelineTrigger = "pipeline"
+	// PubSubTrigger is the name of the type in the spinnaker json for pipeline config for pub/sub triggers
+	PubSubTrigger = "pubsub"
 	// LoadBalancerFormat creates the label selectors to attach pipeline.yml labels to deployment selectors
 	LoadBalancerFormat = "load-balancer-%s"
 	// HourInMS provides 1 hour in milliseconds
@@ -69,14 +73,25 @@ type Builder struct {
 	pipeline *config.Pipeline
 
 	isLinear         bool
+	isHybrid         bool
 	basePath         string
+	rootPath         string
+	remote           *remote.Fetcher
 	timeoutHours     int
 	overrideAccounts map[string]string
+	pipelineID       string
+	deterministicID  bool
+	workloads        Workloads
+	fsys             fs.FS
+	environmentMaps  []config.Environments
+
+	// baked are the manifest artifacts the bake stages of the pipeline produce
+	baked map[string]bool
 }
 
 // New initializes a new builder for a pipeline config
 func New(p *config.Pipeline, opts ...OptFunc) *Builder {
-	b := &Builder{pipeline: p}
+	b := &Builder{pipeline: p, workloads: DefaultWorkloads()}
 	for _, opt := range opts {
 		opt(b)
 	}
@@ -88,21 +103,52 @@ func New(p *config.Pipeline, opts ...OptFunc) *Builder {
 // config
 func (b *Builder) Pipeline() (*types.SpinnakerPipeline, error) {
 	sp := &types.SpinnakerPipeline{
+		ID:                   b.buildPipelineID(),
+		Name:                 b.pipeline.Name,
+		Application:          b.pipeline.Application,
 		LimitConcurrent:      b.pipeline.DisableConcurrentExecutions,
 		KeepWaitingPipelines: b.pipeline.KeepQueuedPipelines,
 		Description:          b.pipeline.Description,
 		AppConfig:            map[string]interface{}{},
 	}
 
+	if envs := b.pipeline.Environments; envs != nil {
+		if err := envs.Validate(); err != nil {
+			return sp, err
+		}
+	}
+
+	descriptions, err := triggerImageDescriptions(b.pipeline)
+	if err != nil {
+		return sp, err
+	}
+	if descriptions != nil {
+		// stages read the image descriptions through the pipeline config, the
+		// rest of the build uses a copy so the builder itself doesn't change
+		p := *b.pipeline
+		p.ImageDescriptions = descriptions
+		b = b.withPipeline(&p)
+	}
+
 	sp.Notifications = buildNotifications(b.pipeline.Notifications)
+	sp.ExpectedArtifacts, err = buildExpectedArtifacts(b.pipeline.ExpectedArtifacts)
+	if err != nil {
+		return sp, err
+	}
+
 	sp.Triggers = make([]types.Trigger, 0)
 
-	for _, trigger := range b.pipeline.Triggers {
+	for i, trigger := range b.pipeline.Triggers {
+		if err := b.checkArtifactIDs(triggerArtifactIDs(trigger)); err != nil {
+			return sp, errors.Wrapf(err, "trigger %d", i)
+		}
+
 		if jt := trigger.Jenkins; jt != nil {
 			sp.Triggers = append(sp.Triggers, &types.JenkinsTrigger{
 				TriggerObject: types.TriggerObject{
-					Enabled: newDefaultTrue(jt.Enabled),
-					Type:    JenkinsTrigger,
+					Enabled:             newDefaultTrue(jt.Enabled),
+					Type:                JenkinsTrigger,
+					ExpectedArtifactIDs: jt.ExpectedArtifactIDs,
 				},
 
 				Job:          jt.Job,
@@ -114,12 +160,82 @@ func (b *Builder) Pipeline() (*types.SpinnakerPipeline, error) {
 		if wh := trigger.Webhook; wh != nil {
 			sp.Triggers = append(sp.Triggers, &types.WebhookTrigger{
 				TriggerObject: types.TriggerObject{
-					Enabled: wh.Enabled,
-					Type:    WebhookTrigger,
+					Enabled:             wh.Enabled,
+					Type:                WebhookTrigger,
+					ExpectedArtifactIDs: wh.ExpectedArtifactIDs,
 				},
 				Source: wh.Source,
 			})
 		}
+
+		if dt := trigger.Docker; dt != nil {
+			sp.Triggers = append(sp.Triggers, &types.DockerTrigger{
+				TriggerObject: types.TriggerObject{
+					Enabled:             newDefaultTrue(dt.Enabled),
+					Type:                DockerTrigger,
+					ExpectedArtifactIDs: dt.ExpectedArtifactIDs,
+				},
+				Account:      dt.Account,
+				Organization: dt.Organization,
+				Registry:     dt.Registry,
+				Repository:   dt.Repository,
+				Tag:          dt.Tag,
+			})
+		}
+
+		if gt := trigger.Git; gt != nil {
+			sp.Triggers = append(sp.Triggers, &types.GitTrigger{
+				TriggerObject: types.TriggerObject{
+					Enabled:             newDefaultTrue(gt.Enabled),
+					Type:                GitTrigger,
+					ExpectedArtifactIDs: gt.ExpectedArtifactIDs,
+				},
+				Source:  gt.Source,
+				Project: gt.Project,
+				Slug:    gt.Slug,
+				Branch:  gt.Branch,
+				Secret:  gt.Secret,
+			})
+		}
+
+		if ct := trigger.Cron; ct != nil {
+			sp.Triggers = append(sp.Triggers, &types.CronTrigger{
+				TriggerObject: types.TriggerObject{
+					Enabled:             newDefaultTrue(ct.Enabled),
+					Type:                CronTrigger,
+					ExpectedArtifactIDs: ct.ExpectedArtifactIDs,
+				},
+				CronExpression: ct.Expression,
+				CronTimeZone:   ct.TimeZone,
+			})
+		}
+
+		if pt := trigger.Pipeline; pt != nil {
+			sp.Triggers = append(sp.Triggers, &types.PipelineTrigger{
+				TriggerObject: types.TriggerObject{
+					Enabled:             newDefaultTrue(pt.Enabled),
+					Type:                PipelineTrigger,
+					ExpectedArtifactIDs: pt.ExpectedArtifactIDs,
+				},
+				Application: pt.Application,
+				Pipeline:    pt.Pipeline,
+				Status:      pt.Status,
+			})
+		}
+
+		if pt := trigger.PubSub; pt != nil {
+			sp.Triggers = append(sp.Triggers, &types.PubSubTrigger{
+				TriggerObject: types.TriggerObject{
+					Enabled:             newDefaultTrue(pt.Enabled),
+					Type:                PubSubTrigger,
+					ExpectedArtifactIDs: pt.ExpectedArtifactIDs,
+				},
+				PubSubSystem:         pt.System,
+				SubscriptionName:     pt.Subscription,
+				PayloadConstraints:   pt.PayloadConstraints,
+				AttributeConstraints: pt.AttributeConstraints,
+			})
+		}
 	}
 
 	sp.Parameters = make([]types.Parameter, len(b.pipeline.Parameters))
@@ -146,11 +262,37 @@ func (b *Builder) Pipeline() (*types.SpinnakerPipeline, error) {
 		}
 	}
 
+	stages := b.pipeline.Stages
+	if b.isLinear && b.isHybrid {
+		return sp, ErrLinearAndHybrid
+	}
+	if b.isHybrid {
+		var err error
+		if stages, err = resolveHybridRefs(stages); err != nil {
+			return sp, err
+		}
+	}
+
+	if b.baked, err = b.bakeOutputs(stages); err != nil {
+		return sp, err
+	}
+	if err := checkBakedChartsDeployed(stages); err != nil {
+		return sp, err
+	}
+
 	var stageIndex = 0
-	for _, stage := range b.pipeline.Stages {
+	for i, stage := range stages {
 		var s types.Stage
 		var err error
 
+		stageTypes := stage.Types()
+		if len(stageTypes) == 0 {
+			return sp, errors.Wrapf(ErrNoStageType, "stage %d (%s)", i+1, stage.Name)
+		}
+		if len(stageTypes) > 1 {
+			return sp, errors.Wrapf(ErrMultipleStageTypes, "stage %d (%s): %s", i+1, stage.Name, strings.Join(stageTypes, ", "))
+		}
+
 		// if the account has an override, switch the account name
 		if account, ok := b.overrideAccounts[stage.Account]; ok {
 			stage.Account = account
@@ -179,7 +321,13 @@ func (b *Builder) Pipeline() (*types.SpinnakerPipeline, error) {
 			stageIndex = stageIndex + 1
 		}
 
-		if stage.DeployEmbeddedManifests != nil {
+		if stage.DeployEmbeddedManifests != nil && stage.DeployEmbeddedManifests.BakesHelmChart() {
+			s, err = b.buildHelmBakeStage(stageIndex, stage)
+			if err != nil {
+				return sp, fmt.Errorf("Failed to buildHelmBakeStage with error: %s", err)
+			}
+			stageIndex = stageIndex + 1
+		} else if stage.DeployEmbeddedManifests != nil {
 			s, err = b.buildDeployEmbeddedManifestStage(stageIndex, stage)
 			if err != nil {
 				return sp, fmt.Errorf("Failed to buildDeployEmbeddedManifestStage with error: %s", err)
@@ -227,6 +375,14 @@ func (b *Builder) Pipeline() (*types.SpinnakerPipeline, error) {
 			stageIndex++
 		}
 
+		if stage.BakeManifest != nil {
+			s, err = b.buildBakeManifestStage(stageIndex, stage)
+			if err != nil {
+				return sp, fmt.Errorf("Failed to buildBakeManifestStage with error: %v", err)
+			}
+			stageIndex++
+		}
+
 		if stage.RunSpinnakerPipeline != nil {
 			s, err = b.buildRunSpinnakerPipelineStage(stageIndex, stage)
 			if err != nil {
@@ -241,6 +397,63 @@ func (b *Builder) Pipeline() (*types.SpinnakerPipeline, error) {
 	return sp, nil
 }
 
+// IsLinear reports whether the builder assigns the refIds of every stage in order
+func (b *Builder) IsLinear() bool {
+	return b.isLinear
+}
+
+// Workloads returns the kinds the builder finds the containers of embedded manifests in
+func (b *Builder) Workloads() Workloads {
+	return b.workloads
+}
+
+// withPipeline returns a copy of the builder that builds p
+func (b *Builder) withPipeline(p *config.Pipeline) *Builder {
+	build := *b
+	build.pipeline = p
+	return &build
+}
+
+// IsIDDerived reports whether the ID of the built pipeline is derived from the
+// application and pipeline name rather than set by an option or the config
+func (b *Builder) IsIDDerived() bool {
+	return b.deterministicID && b.pipelineID == "" && b.pipeline.ID == ""
+}
+
+// buildPipelineID picks the pipeline ID from the builder options, the pipeline
+// config or (if enabled) a UUID derived from the application and pipeline name
+func (b *Builder) buildPipelineID() string {
+	if b.pipelineID != "" {
+		return b.pipelineID
+	}
+
+	if b.pipeline.ID != "" {
+		return b.pipeline.ID
+	}
+
+	if b.deterministicID {
+		return DeterministicPipelineID(b.pipeline.Application, b.pipeline.Name)
+	}
+
+	return ""
+}
+
+// DeterministicPipelineID returns a name based (version 5) UUID for a pipeline so
+// the same application and pipeline name always produce the same ID
+func DeterministicPipelineID(application, name string) string {
+	h := sha1.New() // #nosec G401 -- sha1 is mandated by RFC 4122 for version 5 UUIDs
+	h.Write(pipelineIDNamespace[:])
+	h.Write([]byte(application + "/" + name))
+	sum := h.Sum(nil)
+
+	var u [16]byte
+	copy(u[:], sum)
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
 // MarshalJSON implements json.Marshaller
 func (b *Builder) MarshalJSON() ([]byte, error) {
 	sp, err := b.Pipeline()
@@ -264,7 +477,7 @@ func (b *Builder) buildRunJobStage(index int, s config.Stage) (*types.RunJobStag
 		ServiceAccountName: s.RunJob.ServiceAccountName,
 	}
 
-	parser := NewManfifestParser(b.pipeline, b.basePath)
+	parser := b.manifestParser()
 
 	mg, err := parser.ContainersFromScaffold(s.RunJob)
 	if err != nil {
@@ -301,10 +514,23 @@ func (b *Builder) buildDeployEmbeddedManifestStage(index int, s config.Stage) (*
 	ds := b.defaultManifestStage(index, s)
 	maniStage := s.DeployEmbeddedManifests
 
-	if len(maniStage.Files)+len(maniStage.ConfiguratorFiles) < 1 {
+	sources := len(maniStage.Files) + len(maniStage.ConfiguratorFiles) + len(maniStage.KustomizeDirs) + len(maniStage.HelmCharts)
+	if maniStage.ManifestArtifactID != "" {
+		if sources > 0 {
+			return nil, ErrManifestArtifactWithFiles
+		}
+		if err := b.manifestArtifact(ds, maniStage.ManifestArtifactID); err != nil {
+			return nil, err
+		}
+	} else if sources < 1 {
 		return nil, ErrNoManifestFiles
 	}
 
+	if err := b.checkArtifactIDs(maniStage.RequiredArtifactIDs); err != nil {
+		return nil, err
+	}
+	ds.RequiredArtifactIDs = maniStage.RequiredArtifactIDs
+
 	// update the moniker
 	if maniStage.DefaultMoniker != nil {
 		ds.Moniker = types.Moniker{
@@ -315,121 +541,72 @@ func (b *Builder) buildDeployEmbeddedManifestStage(index int, s config.Stage) (*
 		}
 	}
 
-	parser := NewManfifestParser(b.pipeline, b.basePath)
+	parser := b.manifestParser()
 	for _, file := range maniStage.Files {
 		objs, err := parser.ManifestsFromFile(file.File)
 		if err != nil {
 			return nil, errors.Wrapf(err, "could not parse manifest file: %s", file.File)
 		}
 
-		for i, obj := range objs {
-			u, ok := obj.(*unstructured.Unstructured)
-			if !ok {
-				return nil, errors.New("manifest parser returned an unexpected object type")
-			}
-
-			if u.GetKind() == "Deployment" || u.GetKind() == "Job" || u.GetKind() == "CronJob" {
-				var c interface{}
-
-				// Gets the containers based on the kind
-				if u.GetKind() == "Deployment" || u.GetKind() == "Job" {
-					// Deployment and Job nested struct
-					c, _, _ = unstructured.NestedFieldNoCopy(u.Object, "spec", "template", "spec", "containers")
-				} else {
-					// CronJob nested struct
-					c, _, _ = unstructured.NestedFieldNoCopy(u.Object, "spec", "jobTemplate", "spec", "template", "spec", "containers")
-				}
-
-				containers := c.([]interface{})
-
-				for i, unstructuredContainer := range containers {
-					container := unstructuredContainer.(map[string]interface{})
-					for _, overrideContainer := range maniStage.ContainerOverrides {
-						if container["name"] != overrideContainer.Name || overrideContainer.Resources == nil {
-							continue
-						}
-						c := (containers[i]).(map[string]interface{})
-						// set resources requests
-						requests, _, _ := unstructured.NestedFieldNoCopy(c, "resources", "requests")
-						requestsTyped, err := toResourceList(requests)
-						if err != nil {
-							return nil, errors.Wrapf(err, "failed to convert resources requests to a resource list for container: %s", overrideContainer.Name)
-						}
-						requests, err = overrideResource(requestsTyped, overrideContainer.Resources.Requests)
-						if err != nil {
-							return nil, errors.Wrapf(err, errOverrideResource, "requests", overrideContainer.Name)
-						}
-						if err := setNestedFieldNoCopy(c, requests, "resources", "requests"); err != nil {
-							return nil, errors.Wrapf(err, "failed to set resources requests for container: %s", overrideContainer.Name)
-						}
-
-						// set resources limits
-						limits, _, _ := unstructured.NestedFieldNoCopy(c, "resources", "limits")
-						limitsTyped, err := toResourceList(limits)
-						if err != nil {
-							return nil, errors.Wrapf(err, "failed to convert resources limits to a resource list for container: %s", overrideContainer.Name)
-						}
-						limits, err = overrideResource(limitsTyped, overrideContainer.Resources.Limits)
-						if err != nil {
-							return nil, errors.Wrapf(err, errOverrideResource, "limits", overrideContainer.Name)
-						}
-						if err := setNestedFieldNoCopy(c, limits, "resources", "limits"); err != nil {
-							return nil, errors.Wrapf(err, "failed to set resources requests for container: %s", overrideContainer.Name)
-						}
-					}
-				}
-				objs[i] = u
-			}
-		}
-
 		ds.Manifests = append(ds.Manifests, objs...)
 	}
 
-	// Generate the configurator config map
+	// Render the configurator config maps in memory
 	for _, configuratorFile := range maniStage.ConfiguratorFiles {
-
-		file, err := ioutil.ReadFile(path.Join(b.basePath, configuratorFile.File))
+		file, err := b.files().ReadFile(configuratorFile.File)
 		if err != nil {
 			return nil, errors.Wrapf(err, "could not read from configurator manifest file: %s", configuratorFile.File)
 		}
 
-		env, ok := Stages[s.Account] // Set env based on account by default
-		if len(configuratorFile.Environment) > 0 {
-			env = configuratorFile.Environment // Allow an override to be set
+		env, err := b.stageEnvironment(s.Account, configuratorFile.Environment)
+		if err != nil {
+			return nil, err
 		}
 
-		if len(env) == 0 && !ok {
-			env = "default" // If env was not set and can not be found in the Stages map, fall back to default
+		var configured bytes.Buffer
+		if err := cnfgrtr.Generate(file, env, &configured); err != nil {
+			return nil, errors.Wrapf(err, "k8s-configurator could not generate manifest file: %s for env: %s", configuratorFile.File, env)
 		}
 
-		destFileName := configuratorFile.File + "." + env
-		destFilePath := path.Join(b.basePath, destFileName)
-		configuredConfigMap, err := os.Create(destFilePath)
+		objs, err := parser.ManifestsFromReader(&configured)
 		if err != nil {
-			return nil, errors.Wrapf(err, "k8s-configurator could not create destination file path: %s", destFilePath)
+			return nil, errors.Wrapf(err, "could not parse manifest file: %s", configuratorFile.File)
 		}
 
-		err = cnfgrtr.Generate(file, env, configuredConfigMap)
+		ds.Manifests = append(ds.Manifests, objs...)
+	}
+
+	for _, kd := range maniStage.KustomizeDirs {
+		objs, err := b.kustomizeManifests(kd, s.Account)
 		if err != nil {
-			os.Remove(destFilePath)
-			return nil, errors.Wrapf(err, "k8s-configurator could not generate manifest file: %s for env: %s", configuratorFile.File, env)
+			return nil, err
 		}
 
-		objs, err := parser.ManifestsFromFile(destFileName)
-		os.Remove(destFilePath)
+		ds.Manifests = append(ds.Manifests, objs...)
+	}
+
+	for _, hc := range maniStage.HelmCharts {
+		objs, err := b.helmManifests(hc)
 		if err != nil {
-			return nil, errors.Wrapf(err, "could not parse manifest file: %s", configuratorFile.File)
+			return nil, err
 		}
 
 		ds.Manifests = append(ds.Manifests, objs...)
+	}
 
+	if err := b.injectImageDescriptions(ds.Manifests, maniStage.ImageDescriptions); err != nil {
+		return nil, err
+	}
+
+	if err := b.applyContainerOverrides(ds.Manifests, maniStage.ContainerOverrides); err != nil {
+		return nil, err
 	}
 
 	return ds, nil
 }
 
 func (b *Builder) buildDeleteEmbeddedManifestStage(index int, s config.Stage) (*types.DeleteManifestStage, error) {
-	parser := NewManfifestParser(b.pipeline, b.basePath)
+	parser := b.manifestParser()
 	file := s.DeleteEmbeddedManifest.File
 
 	objs, err := parser.ManifestsFromFile(file)
@@ -478,57 +655,6 @@ func (b *Builder) buildDeleteEmbeddedManifestStage(index int, s config.Stage) (*
 	return stage, nil
 }
 
-func overrideResource(resourceList corev1.ResourceList, override *config.Resource) (corev1.ResourceList, error) {
-	if override == nil {
-		return resourceList, nil
-	}
-	result := make(corev1.ResourceList)
-	if resourceList != nil {
-		result = resourceList
-	}
-	if override.Memory != "" {
-		memoryQty, err := resource.ParseQuantity(override.Memory)
-		if err != nil {
-			return result, errors.Wrapf(err, "could not parse memory")
-		}
-		result[corev1.ResourceMemory] = memoryQty
-	}
-	if override.CPU != "" {
-		cpuQty, err := resource.ParseQuantity(override.CPU)
-		if err != nil {
-			return result, errors.Wrapf(err, "could not parse memory")
-		}
-		result[corev1.ResourceCPU] = cpuQty
-	}
-	return result, nil
-}
-func toResourceList(i interface{}) (corev1.ResourceList, error) {
-	result := make(corev1.ResourceList)
-
-	if i == nil {
-		return result, nil
-	}
-	resourceList, ok := i.(map[string]interface{})
-	if !ok {
-		return result, nil
-	}
-	if cpu, found := resourceList[corev1.ResourceCPU.String()]; found {
-		cpuQty, err := resource.ParseQuantity(fmt.Sprint(cpu))
-		if err != nil {
-			return result, errors.Wrapf(err, "could not parse cpu")
-		}
-		result[corev1.ResourceCPU] = cpuQty
-	}
-	if memory, found := resourceList[corev1.ResourceMemory.String()]; found {
-		memoryQty, err := resource.ParseQuantity(fmt.Sprint(memory))
-		if err != nil {
-			return result, errors.Wrapf(err, "could not parse memory")
-		}
-		result[corev1.ResourceMemory] = memoryQty
-	}
-	return result, nil
-}
-
 func (b *Builder) defaultManifestStage(index int, s config.Stage) *types.ManifestStage {
 	// Set default values
 	completeOtherBranchesThenFail := setDefaultIfNil(s.DeployEmbeddedManifests.CompleteOtherBranchesThenFail, false)
@@ -727,7 +853,7 @@ func (b *Builder) buildDeployStage(index int, s config.Stage) (*types.DeployStag
 		StageMetadata: buildStageMetadata(s, "deploy", index, b.isLinear),
 	}
 
-	parser := NewManfifestParser(b.pipeline, b.basePath)
+	parser := b.manifestParser()
 
 	for _, group := range s.Deploy.Groups {
 		mg, err := parser.ContainersFromScaffold(group)
@@ -8,6 +8,7 @@ import (
 	"github.com/namely/k8s-pipeliner/pipeline/builder"
 	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
 	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
@@ -56,6 +57,323 @@ func TestBuilderAssignsPipelineConfiguration(t *testing.T) {
 	assert.Equal(t, pipeline.Description, spinnaker.Description)
 }
 
+func TestBuilderAssignsPipelineIdentity(t *testing.T) {
+	t.Run("Name and application are copied from the config", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			Name:        "Deploy nginx",
+			Application: "nginx",
+		}
+
+		spinnaker, err := builder.New(pipeline).Pipeline()
+		require.NoError(t, err, "error generating pipeline json")
+
+		assert.Equal(t, "Deploy nginx", spinnaker.Name)
+		assert.Equal(t, "nginx", spinnaker.Application)
+		assert.Equal(t, "", spinnaker.ID)
+	})
+
+	t.Run("ID is copied from the config", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			ID:          "1234-abcd",
+			Name:        "Deploy nginx",
+			Application: "nginx",
+		}
+
+		spinnaker, err := builder.New(pipeline, builder.WithDeterministicID(true)).Pipeline()
+		require.NoError(t, err, "error generating pipeline json")
+
+		assert.Equal(t, "1234-abcd", spinnaker.ID)
+		assert.False(t, builder.New(pipeline, builder.WithDeterministicID(true)).IsIDDerived())
+	})
+
+	t.Run("WithPipelineID overrides the config", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			ID:          "1234-abcd",
+			Name:        "Deploy nginx",
+			Application: "nginx",
+		}
+
+		spinnaker, err := builder.New(pipeline, builder.WithPipelineID("5678-efgh")).Pipeline()
+		require.NoError(t, err, "error generating pipeline json")
+
+		assert.Equal(t, "5678-efgh", spinnaker.ID)
+	})
+
+	t.Run("Deterministic IDs are stable UUIDs", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			Name:        "Deploy nginx",
+			Application: "nginx",
+		}
+
+		spinnaker, err := builder.New(pipeline, builder.WithDeterministicID(true)).Pipeline()
+		require.NoError(t, err, "error generating pipeline json")
+
+		assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", spinnaker.ID)
+		assert.Equal(t, builder.DeterministicPipelineID("nginx", "Deploy nginx"), spinnaker.ID)
+		assert.NotEqual(t, builder.DeterministicPipelineID("nginx", "Rollback nginx"), spinnaker.ID)
+		assert.NotEqual(t, builder.DeterministicPipelineID("apache", "Deploy nginx"), spinnaker.ID)
+		assert.True(t, builder.New(pipeline, builder.WithDeterministicID(true)).IsIDDerived())
+	})
+}
+
+func TestBuilderRequiresOneStageType(t *testing.T) {
+	t.Run("Stages without a type are rejected", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			Stages: []config.Stage{{Name: "Nothing"}},
+		}
+
+		_, err := builder.New(pipeline).Pipeline()
+		require.Error(t, err)
+		assert.Equal(t, builder.ErrNoStageType, errors.Cause(err))
+		assert.Contains(t, err.Error(), "stage 1 (Nothing)")
+	})
+
+	t.Run("Stages with multiple types are rejected", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			Stages: []config.Stage{
+				{
+					Name:              "Both",
+					ManualJudgement:   &config.ManualJudgementStage{},
+					EvaluateVariables: &config.EvaluateVariablesStage{},
+				},
+			},
+		}
+
+		_, err := builder.New(pipeline).Pipeline()
+		require.Error(t, err)
+		assert.Equal(t, builder.ErrMultipleStageTypes, errors.Cause(err))
+		assert.Contains(t, err.Error(), "manualJudgement, variables")
+	})
+}
+
+func TestBuilderHybridRefs(t *testing.T) {
+	judgement := func(name, refID string, reliesOn ...string) config.Stage {
+		return config.Stage{Name: name, RefID: refID, ReliesOn: reliesOn, ManualJudgement: &config.ManualJudgementStage{}}
+	}
+	refs := func(sp *types.SpinnakerPipeline) [][]string {
+		var out [][]string
+		for _, s := range sp.Stages {
+			md := s.(*types.ManualJudgementStage).StageMetadata
+			out = append(out, append([]string{md.RefID}, md.RequisiteStageRefIds...))
+		}
+		return out
+	}
+
+	t.Run("Symbolic refIds are resolved and stages depend on the previous one by default", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			Stages: []config.Stage{
+				judgement("Build", "build"),
+				judgement("Deploy int", "deploy-int"),
+				judgement("Deploy staging", "deploy-staging", "build"),
+				judgement("Promote", "", "deploy-int", "deploy-staging"),
+				judgement("Notify", ""),
+				judgement("Audit", "audit"),
+			},
+		}
+		pipeline.Stages[5].ReliesOn = []string{}
+
+		spinnaker, err := builder.New(pipeline, builder.WithHybrid(true)).Pipeline()
+		require.NoError(t, err)
+
+		assert.Equal(t, [][]string{
+			{"build"},
+			{"deploy-int", "build"},
+			{"deploy-staging", "build"},
+			{"promote", "deploy-int", "deploy-staging"},
+			{"notify", "promote"},
+			{"audit"},
+		}, refs(spinnaker))
+	})
+
+	t.Run("Missing refIds are derived from the stage name", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			Stages: []config.Stage{
+				judgement("Build", ""),
+				judgement("Deploy", "0"),
+				judgement("Deploy to int?", "", "0"),
+				judgement("", ""),
+			},
+		}
+
+		spinnaker, err := builder.New(pipeline, builder.WithHybrid(true)).Pipeline()
+		require.NoError(t, err)
+
+		assert.Equal(t, [][]string{{"build"}, {"0", "build"}, {"deploy-to-int", "0"}, {"stage", "deploy-to-int"}}, refs(spinnaker))
+	})
+
+	t.Run("Stages whose names derive a taken refId need to declare one", func(t *testing.T) {
+		pipeline := &config.Pipeline{Stages: []config.Stage{judgement("Deploy int", ""), judgement("Deploy int", "")}}
+		_, err := builder.New(pipeline, builder.WithHybrid(true)).Pipeline()
+		assert.Equal(t, builder.ErrAmbiguousRefID, errors.Cause(err))
+
+		pipeline = &config.Pipeline{Stages: []config.Stage{judgement("Build", ""), judgement("Compile", "build")}}
+		_, err = builder.New(pipeline, builder.WithHybrid(true)).Pipeline()
+		assert.Equal(t, builder.ErrAmbiguousRefID, errors.Cause(err))
+
+		pipeline = &config.Pipeline{Stages: []config.Stage{judgement("Deploy int", ""), judgement("Deploy int", "deploy-int-canary")}}
+		_, err = builder.New(pipeline, builder.WithHybrid(true)).Pipeline()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Inserting a stage keeps the refIds of the others", func(t *testing.T) {
+		stages := []config.Stage{
+			judgement("Build", "build"),
+			judgement("Deploy int", ""),
+			judgement("Promote", "promote", "build"),
+		}
+
+		before, err := builder.New(&config.Pipeline{Stages: stages}, builder.WithHybrid(true)).Pipeline()
+		require.NoError(t, err)
+
+		inserted := append([]config.Stage{judgement("Lint", "")}, stages...)
+		after, err := builder.New(&config.Pipeline{Stages: inserted}, builder.WithHybrid(true)).Pipeline()
+		require.NoError(t, err)
+
+		var beforeIDs, afterIDs []string
+		for _, r := range refs(before) {
+			beforeIDs = append(beforeIDs, r[0])
+		}
+		for _, r := range refs(after)[1:] {
+			afterIDs = append(afterIDs, r[0])
+		}
+		assert.Equal(t, beforeIDs, afterIDs)
+		assert.Equal(t, []string{"build", "deploy-int", "promote"}, afterIDs)
+	})
+
+	t.Run("Unknown and duplicate refIds are rejected", func(t *testing.T) {
+		pipeline := &config.Pipeline{Stages: []config.Stage{judgement("Build", "build"), judgement("Deploy", "deploy", "bulid")}}
+		_, err := builder.New(pipeline, builder.WithHybrid(true)).Pipeline()
+		assert.Equal(t, builder.ErrUnknownRefID, errors.Cause(err))
+
+		pipeline = &config.Pipeline{Stages: []config.Stage{judgement("Build", "build"), judgement("Deploy", "build")}}
+		_, err = builder.New(pipeline, builder.WithHybrid(true)).Pipeline()
+		assert.Equal(t, builder.ErrDuplicateRefID, errors.Cause(err))
+	})
+
+	t.Run("Linear and hybrid can't be combined", func(t *testing.T) {
+		_, err := builder.New(&config.Pipeline{}, builder.WithHybrid(true), builder.WithLinear(true)).Pipeline()
+		assert.Equal(t, builder.ErrLinearAndHybrid, err)
+	})
+}
+
+func TestBuilderExpectedArtifacts(t *testing.T) {
+	image := config.ExpectedArtifact{ID: "image", Match: config.Artifact{Type: "docker/image", Name: "namely/web"}}
+	manifest := config.ExpectedArtifact{ID: "manifest", Match: config.Artifact{Type: "github/file", Name: "web.yml"}}
+	deploy := func(m *config.DeployEmbeddedManifests) []config.Stage {
+		return []config.Stage{{Name: "Deploy", Account: "int-k8s", DeployEmbeddedManifests: m}}
+	}
+
+	t.Run("Artifact types and ids are checked", func(t *testing.T) {
+		pipeline := &config.Pipeline{ExpectedArtifacts: []config.ExpectedArtifact{{ID: "jar", Match: config.Artifact{Type: "maven/file"}}}}
+		_, err := builder.New(pipeline).Pipeline()
+		assert.Equal(t, builder.ErrUnknownArtifactType, errors.Cause(err))
+
+		pipeline = &config.Pipeline{ExpectedArtifacts: []config.ExpectedArtifact{image, image}}
+		_, err = builder.New(pipeline).Pipeline()
+		assert.Equal(t, builder.ErrDuplicateArtifactID, errors.Cause(err))
+	})
+
+	t.Run("Triggers and stages reference declared artifacts", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			ExpectedArtifacts: []config.ExpectedArtifact{image},
+			Triggers:          []config.Trigger{{Docker: &config.DockerTrigger{Account: "registry", Repository: "namely/web", ExpectedArtifactIDs: []string{"imgae"}}}},
+		}
+		_, err := builder.New(pipeline).Pipeline()
+		assert.Equal(t, builder.ErrUnknownArtifactID, errors.Cause(err))
+
+		pipeline = &config.Pipeline{
+			ExpectedArtifacts: []config.ExpectedArtifact{image},
+			Stages:            deploy(&config.DeployEmbeddedManifests{ManifestArtifactID: "manifest"}),
+		}
+		_, err = builder.New(pipeline).Pipeline()
+		assert.Contains(t, err.Error(), builder.ErrUnknownArtifactID.Error())
+	})
+
+	t.Run("Manifest artifacts are deployed from the artifact", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			ExpectedArtifacts: []config.ExpectedArtifact{image, manifest},
+			Stages:            deploy(&config.DeployEmbeddedManifests{ManifestArtifactID: "image"}),
+		}
+		_, err := builder.New(pipeline).Pipeline()
+		assert.Contains(t, err.Error(), builder.ErrNotManifestArtifact.Error())
+
+		pipeline.Stages = deploy(&config.DeployEmbeddedManifests{ManifestArtifactID: "manifest", Files: []config.ManifestFile{{File: "web.yml"}}})
+		_, err = builder.New(pipeline).Pipeline()
+		assert.Contains(t, err.Error(), builder.ErrManifestArtifactWithFiles.Error())
+
+		pipeline.Stages = deploy(&config.DeployEmbeddedManifests{ManifestArtifactID: "manifest", RequiredArtifactIDs: []string{"image"}})
+		spinnaker, err := builder.New(pipeline).Pipeline()
+		require.NoError(t, err)
+
+		stage := spinnaker.Stages[0].(*types.ManifestStage)
+		assert.Equal(t, "artifact", stage.Source)
+		assert.Equal(t, "manifest", stage.ManifestArtifactID)
+		assert.Equal(t, []string{"image"}, stage.RequiredArtifactIDs)
+		assert.Empty(t, stage.Manifests)
+	})
+}
+
+func TestBuilderBakeManifest(t *testing.T) {
+	chart := config.ExpectedArtifact{ID: "chart", Match: config.Artifact{Type: "helm/chart", Name: "web", Account: "charts"}}
+	bake := func(bm *config.BakeManifestStage) config.Stage {
+		return config.Stage{Name: "Bake", RefID: "bake", BakeManifest: bm}
+	}
+	deploy := config.Stage{Name: "Deploy", Account: "int-k8s", RefID: "deploy", ReliesOn: []string{"bake"}, DeployEmbeddedManifests: &config.DeployEmbeddedManifests{ManifestArtifactID: "web"}}
+
+	t.Run("Baked manifests are deployed by their output name", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			ExpectedArtifacts: []config.ExpectedArtifact{chart},
+			Stages: []config.Stage{
+				bake(&config.BakeManifestStage{TemplateRenderer: "HELM3", OutputName: "web", InputArtifacts: []config.InputArtifact{{ID: "chart"}}}),
+				deploy,
+			},
+		}
+		spinnaker, err := builder.New(pipeline).Pipeline()
+		require.NoError(t, err)
+
+		bs := spinnaker.Stages[0].(*types.BakeManifestStage)
+		assert.Equal(t, "bakeManifest", bs.Type)
+		assert.Equal(t, []types.InputArtifact{{Account: "charts", ID: "chart"}}, bs.InputArtifacts)
+		assert.Equal(t, map[string]string{}, bs.Overrides)
+		require.Len(t, bs.ExpectedArtifacts, 1)
+		assert.Equal(t, "web", bs.ExpectedArtifacts[0].ID)
+
+		ms := spinnaker.Stages[1].(*types.ManifestStage)
+		assert.Equal(t, "artifact", ms.Source)
+		assert.Equal(t, "web", ms.ManifestArtifactID)
+		assert.Equal(t, "embedded-artifact", ms.ManifestArtifactAccount)
+	})
+
+	t.Run("Output names can not reuse artifact ids", func(t *testing.T) {
+		pipeline := &config.Pipeline{
+			ExpectedArtifacts: []config.ExpectedArtifact{chart},
+			Stages:            []config.Stage{bake(&config.BakeManifestStage{TemplateRenderer: "HELM3", OutputName: "chart"})},
+		}
+		_, err := builder.New(pipeline).Pipeline()
+		assert.Equal(t, builder.ErrDuplicateArtifactID, errors.Cause(err))
+	})
+
+	t.Run("Bakes are checked", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			bake *config.BakeManifestStage
+			err  error
+		}{
+			"unknown renderer":        {&config.BakeManifestStage{TemplateRenderer: "JSONNET", OutputName: "web"}, builder.ErrUnknownTemplateRenderer},
+			"no output name":          {&config.BakeManifestStage{TemplateRenderer: "HELM3"}, builder.ErrNoBakeOutputName},
+			"unknown input":           {&config.BakeManifestStage{TemplateRenderer: "HELM3", OutputName: "web", InputArtifacts: []config.InputArtifact{{ID: "values"}}}, builder.ErrUnknownArtifactID},
+			"kustomize without path":  {&config.BakeManifestStage{TemplateRenderer: "KUSTOMIZE", OutputName: "web", InputArtifacts: []config.InputArtifact{{ID: "chart"}}}, builder.ErrKustomizeBake},
+			"kustomize without input": {&config.BakeManifestStage{TemplateRenderer: "KUSTOMIZE4", OutputName: "web", KustomizeFilePath: "kustomization.yaml"}, builder.ErrKustomizeBake},
+		} {
+			t.Run(name, func(t *testing.T) {
+				pipeline := &config.Pipeline{ExpectedArtifacts: []config.ExpectedArtifact{chart}, Stages: []config.Stage{bake(tc.bake)}}
+				_, err := builder.New(pipeline).Pipeline()
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err.Error())
+			})
+		}
+	})
+}
+
 func TestBuilderPipelineStages(t *testing.T) {
 	wd, _ := os.Getwd()
 	file := filepath.Join(wd, "testdata", "deployment.full.yml")
@@ -148,6 +466,162 @@ func TestBuilderPipelineStages(t *testing.T) {
 			assert.Equal(t, builder.WebhookTrigger, whTrigger.Type)
 			assert.Equal(t, "this-is-a-test", whTrigger.Source)
 		})
+
+		t.Run("DockerTrigger is configured correctly and enabled", func(t *testing.T) {
+			pipeline := &config.Pipeline{
+				Triggers: []config.Trigger{
+					{
+						Docker: &config.DockerTrigger{
+							Account:      "namely-registry",
+							Registry:     "registry.namely.land",
+							Organization: "namely",
+							Repository:   "namely/web",
+							Tag:          "^v[0-9.]+$",
+						},
+					},
+				},
+			}
+
+			spinnaker, err := builder.New(pipeline).Pipeline()
+			require.NoError(t, err, "error generating pipeline json")
+			require.Len(t, spinnaker.Triggers, 1)
+
+			assert.Equal(t, &types.DockerTrigger{
+				TriggerObject: types.TriggerObject{Enabled: true, Type: builder.DockerTrigger},
+				Account:       "namely-registry",
+				Registry:      "registry.namely.land",
+				Organization:  "namely",
+				Repository:    "namely/web",
+				Tag:           "^v[0-9.]+$",
+			}, spinnaker.Triggers[0])
+		})
+
+		t.Run("Image descriptions use the pushed tag of the docker trigger", func(t *testing.T) {
+			pipeline := &config.Pipeline{
+				Triggers: []config.Trigger{
+					{Docker: &config.DockerTrigger{Account: "namely-registry", Registry: "registry.namely.land", Repository: "namely/web"}},
+				},
+				ImageDescriptions: []config.ImageDescription{
+					{Name: "web", FromTrigger: true},
+				},
+				Stages: []config.Stage{
+					{
+						Name: "Deploy",
+						Deploy: &config.DeployStage{
+							Groups: []config.Group{
+								{
+									ManifestFile:      file,
+									ImageDescriptions: []config.ImageDescriptionRef{{Name: "web", ContainerName: "test-container"}},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			spinnaker, err := builder.New(pipeline).Pipeline()
+			require.NoError(t, err, "error generating pipeline json")
+
+			container := spinnaker.Stages[0].(*types.DeployStage).Clusters[0].Containers[0]
+			require.Equal(t, "test-container", container.Name)
+			assert.Equal(t, types.ImageDescription{
+				Account:     "namely-registry",
+				FromTrigger: true,
+				ImageID:     "registry.namely.land/namely/web:${trigger['tag']}",
+				Registry:    "registry.namely.land",
+				Repository:  "namely/web",
+				Tag:         "${trigger['tag']}",
+			}, container.ImageDescription)
+			assert.Empty(t, pipeline.ImageDescriptions[0].Repository, "the pipeline config is not modified")
+		})
+
+		t.Run("Builders are not modified by building", func(t *testing.T) {
+			pipeline := &config.Pipeline{
+				Triggers: []config.Trigger{
+					{Docker: &config.DockerTrigger{Account: "namely-registry", Registry: "registry.namely.land", Repository: "namely/web"}},
+				},
+				ImageDescriptions: []config.ImageDescription{{Name: "web", FromTrigger: true}},
+				Stages: []config.Stage{{
+					Name: "Deploy",
+					Deploy: &config.DeployStage{Groups: []config.Group{{
+						ManifestFile:      file,
+						ImageDescriptions: []config.ImageDescriptionRef{{Name: "web", ContainerName: "test-container"}},
+					}}},
+				}},
+			}
+			b := builder.New(pipeline)
+
+			_, err := b.Pipeline()
+			require.NoError(t, err)
+
+			pipeline.Triggers = []config.Trigger{
+				{Docker: &config.DockerTrigger{Account: "namely-registry", Registry: "registry.example.com", Repository: "namely/web"}},
+			}
+			spinnaker, err := b.Pipeline()
+			require.NoError(t, err)
+
+			container := spinnaker.Stages[0].(*types.DeployStage).Clusters[0].Containers[0]
+			assert.Equal(t, "registry.example.com", container.ImageDescription.Registry, "the second build reads the current config")
+		})
+
+		t.Run("Image descriptions need a matching docker trigger", func(t *testing.T) {
+			pipeline := &config.Pipeline{
+				Triggers: []config.Trigger{
+					{Docker: &config.DockerTrigger{Account: "namely-registry", Repository: "namely/web"}},
+					{Docker: &config.DockerTrigger{Account: "namely-registry", Repository: "namely/worker"}},
+				},
+				ImageDescriptions: []config.ImageDescription{{Name: "api", FromTrigger: true, Repository: "namely/api"}},
+			}
+
+			_, err := builder.New(pipeline).Pipeline()
+			assert.Equal(t, builder.ErrNoDockerTrigger, errors.Cause(err))
+
+			pipeline.ImageDescriptions[0].Repository = ""
+			_, err = builder.New(pipeline).Pipeline()
+			assert.Equal(t, builder.ErrAmbiguousDockerTrigger, errors.Cause(err))
+		})
+
+		t.Run("Git, cron, pipeline and pubsub triggers are configured correctly", func(t *testing.T) {
+			disabled := false
+			pipeline := &config.Pipeline{
+				Triggers: []config.Trigger{
+					{Git: &config.GitTrigger{Source: "github", Project: "namely", Slug: "web", Branch: "master"}},
+					{Cron: &config.CronTrigger{Expression: "0 0 10 ? * MON-FRI", TimeZone: "America/New_York", Enabled: &disabled}},
+					{Pipeline: &config.PipelineTrigger{Application: "web", Pipeline: "0f2c4d6e", Status: []string{"successful"}}},
+					{PubSub: &config.PubSubTrigger{System: "google", Subscription: "deploys", PayloadConstraints: map[string]string{"app": "web"}}},
+				},
+			}
+
+			spinnaker, err := builder.New(pipeline).Pipeline()
+			require.NoError(t, err, "error generating pipeline json")
+
+			assert.Equal(t, []types.Trigger{
+				&types.GitTrigger{
+					TriggerObject: types.TriggerObject{Enabled: true, Type: builder.GitTrigger},
+					Source:        "github",
+					Project:       "namely",
+					Slug:          "web",
+					Branch:        "master",
+				},
+				&types.CronTrigger{
+					TriggerObject:  types.TriggerObject{Enabled: false, Type: builder.CronTrigger},
+					CronExpression: "0 0 10 ? * MON-FRI",
+					CronTimeZone:   "America/New_York",
+				},
+				&types.PipelineTrigger{
+					TriggerObject: types.TriggerObject{Enabled: true, Type: builder.PipelineTrigger},
+					Application:   "web",
+					Pipeline:      "0f2c4d6e",
+					Status:        []string{"successful"},
+				},
+				&types.PubSubTrigger{
+					TriggerObject:      types.TriggerObject{Enabled: true, Type: builder.PubSubTrigger},
+					PubSubSystem:       "google",
+					SubscriptionName:   "deploys",
+					PayloadConstraints: map[string]string{"app": "web"},
+				},
+			}, spinnaker.Triggers)
+		})
 	})
 
 	t.Run("Parameter configuration is parsed correctly", func(t *testing.T) {
@@ -1,9 +1,14 @@
 package builder_test
 
 import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
+	"helm.sh/helm/v3/pkg/chart/loader"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/namely/k8s-pipeliner/pipeline/builder"
@@ -144,6 +149,38 @@ func (em *EmbeddedManifestTest) TestConfiguratorFilesBasePath() {
 	em.Equal("ConfigMap", cm.GetKind())
 }
 
+func (em *EmbeddedManifestTest) TestConfiguratorFilesAreRenderedInMemory() {
+	em.AppendStage(config.Stage{
+		Name:    "deploy cm",
+		Account: "int-k8s",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			ConfiguratorFiles: []config.ManifestFile{{File: "configurator.yml"}},
+		},
+	})
+
+	dir := em.T().TempDir()
+	source, err := os.ReadFile("testdata/configurator.yml")
+	em.Require().NoError(err)
+	em.Require().NoError(os.WriteFile(filepath.Join(dir, "configurator.yml"), source, 0644))
+	// a file of the repository that happens to use the name of the rendered output
+	em.Require().NoError(os.WriteFile(filepath.Join(dir, "configurator.yml.int"), []byte("keep"), 0644))
+
+	pipeline, err := em.BuilderWithBasePath(dir).Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	stg, ok := pipeline.Stages[0].(*types.ManifestStage)
+	em.Require().True(ok)
+	em.Require().Len(stg.Manifests, 1)
+
+	kept, err := os.ReadFile(filepath.Join(dir, "configurator.yml.int"))
+	em.Require().NoError(err)
+	em.Equal("keep", string(kept))
+
+	entries, err := os.ReadDir(dir)
+	em.Require().NoError(err)
+	em.Len(entries, 2, "nothing is written next to the configurator file")
+}
+
 func (em *EmbeddedManifestTest) TestBadConfiguratorFiles() {
 	em.AppendStage(config.Stage{
 		Name: "deploy cm",
@@ -340,6 +377,480 @@ func (em *EmbeddedManifestTest) TestDeleteEmbeddedManifestDefaultProperties() {
 	em.Equal(&boolt, stg.WaitForCompletion)
 }
 
+func (em *EmbeddedManifestTest) TestImageDescriptionsAreInjected() {
+	em.pipeline.Triggers = []config.Trigger{
+		{Docker: &config.DockerTrigger{Account: "namely-registry", Registry: "registry.namely.land", Repository: "namely/ubuntu"}},
+	}
+	em.pipeline.ImageDescriptions = []config.ImageDescription{{Name: "ubuntu", FromTrigger: true}}
+	em.AppendStage(config.Stage{
+		Name: "deploy pod",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			Files: []config.ManifestFile{
+				{
+					File: "testdata/podspec.yml",
+				},
+			},
+			ImageDescriptions: []config.ImageDescriptionRef{{Name: "ubuntu", ContainerName: "test-ref"}},
+		},
+	})
+
+	pipeline, err := em.Builder().Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	stg, ok := pipeline.Stages[0].(*types.ManifestStage)
+	em.Require().True(ok)
+
+	pod, ok := stg.Manifests[0].(*unstructured.Unstructured)
+	em.Require().True(ok)
+
+	containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", "containers")
+	em.Require().Len(containers, 1)
+	em.Equal("registry.namely.land/namely/ubuntu:${trigger['tag']}", containers[0].(map[string]interface{})["image"])
+}
+
+func (em *EmbeddedManifestTest) TestImageDescriptionsNeedAContainer() {
+	em.pipeline.ImageDescriptions = []config.ImageDescription{{Name: "ubuntu", ImageID: "ubuntu:bionic"}}
+	em.AppendStage(config.Stage{
+		Name: "deploy pod",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			Files: []config.ManifestFile{
+				{
+					File: "testdata/podspec.yml",
+				},
+			},
+			ImageDescriptions: []config.ImageDescriptionRef{{Name: "ubuntu", ContainerName: "ubuntu"}},
+		},
+	})
+
+	_, err := em.Builder().Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), builder.ErrNoImageContainer.Error())
+
+	em.pipeline.Stages[0].DeployEmbeddedManifests.ImageDescriptions[0] = config.ImageDescriptionRef{Name: "debian", ContainerName: "test-ref"}
+	_, err = em.Builder().Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), builder.ErrUnknownImageDescription.Error())
+}
+
+func (em *EmbeddedManifestTest) TestContainerOverridesNeedAContainer() {
+	em.AppendStage(config.Stage{
+		Name: "deploy nginx",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			Files: []config.ManifestFile{
+				{
+					File: "testdata/nginx-deployment.yml",
+				},
+			},
+			ContainerOverrides: []*config.ContainerOverrides{{Name: "proxy", Args: []string{"--verbose"}}},
+		},
+	})
+
+	_, err := em.Builder().Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), builder.ErrNoOverrideContainer.Error())
+}
+
+func (em *EmbeddedManifestTest) TestContainerOverridesKeepOtherResources() {
+	em.AppendStage(config.Stage{
+		Name: "deploy trainer",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			Files: []config.ManifestFile{
+				{
+					File: "testdata/deployment.resources.yml",
+				},
+			},
+			ContainerOverrides: []*config.ContainerOverrides{{
+				Name: "trainer",
+				Resources: &config.Resources{
+					Requests: &config.Resource{CPU: "250m"},
+					Limits:   &config.Resource{CPU: "2", Memory: "4Gi"},
+				},
+			}},
+		},
+	})
+
+	pipeline, err := em.Builder().Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	stg, ok := pipeline.Stages[0].(*types.ManifestStage)
+	em.Require().True(ok)
+	u, ok := stg.Manifests[0].(*unstructured.Unstructured)
+	em.Require().True(ok)
+
+	// the manifest is still valid unstructured content
+	u = u.DeepCopy()
+	containers, _, err := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "containers")
+	em.Require().NoError(err)
+	em.Require().Len(containers, 1)
+
+	requests, _, err := unstructured.NestedMap(containers[0].(map[string]interface{}), "resources", "requests")
+	em.Require().NoError(err)
+	em.Equal(map[string]interface{}{"cpu": "250m", "ephemeral-storage": "2Gi"}, requests)
+
+	limits, _, err := unstructured.NestedMap(containers[0].(map[string]interface{}), "resources", "limits")
+	em.Require().NoError(err)
+	em.Equal(map[string]interface{}{"cpu": "2", "memory": "4Gi", "nvidia.com/gpu": int64(1)}, limits)
+}
+
+func (em *EmbeddedManifestTest) TestContainerOverridesOfTheSameContainerAddUp() {
+	em.AppendStage(config.Stage{
+		Name: "deploy nginx",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			Files: []config.ManifestFile{
+				{
+					File: "testdata/nginx-deployment.yml",
+				},
+			},
+			ContainerOverrides: []*config.ContainerOverrides{
+				{Name: "nginx", Resources: &config.Resources{Requests: &config.Resource{CPU: "100m"}}},
+				{Name: "nginx", Resources: &config.Resources{Requests: &config.Resource{Memory: "128Mi"}}},
+			},
+		},
+	})
+
+	pipeline, err := em.Builder().Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	stg, ok := pipeline.Stages[0].(*types.ManifestStage)
+	em.Require().True(ok)
+	u, ok := stg.Manifests[0].(*unstructured.Unstructured)
+	em.Require().True(ok)
+
+	containers, _, err := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "containers")
+	em.Require().NoError(err)
+	requests, _, err := unstructured.NestedStringMap(containers[0].(map[string]interface{}), "resources", "requests")
+	em.Require().NoError(err)
+	em.Equal(map[string]string{"cpu": "100m", "memory": "128Mi"}, requests)
+}
+
+func (em *EmbeddedManifestTest) TestContainerOverridesUseRegisteredWorkloads() {
+	em.AppendStage(config.Stage{
+		Name: "deploy log agents",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			Files: []config.ManifestFile{
+				{
+					File: "testdata/pod-workloads.yml",
+				},
+			},
+			ContainerOverrides: []*config.ContainerOverrides{{Name: "agent", Args: []string{"--verbose"}}},
+		},
+	})
+
+	pipeline, err := builder.New(em.pipeline, builder.WithWorkloads(config.Workload{
+		Group:       "workers.namely.com",
+		Kind:        "Worker",
+		PodSpecPath: "spec.podTemplate.spec",
+	})).Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	stg, ok := pipeline.Stages[0].(*types.ManifestStage)
+	em.Require().True(ok)
+	em.Require().Len(stg.Manifests, 4)
+
+	w := builder.DefaultWorkloads()
+	w.Register("workers.namely.com", "Worker", "spec", "podTemplate", "spec")
+	for _, obj := range stg.Manifests {
+		u, ok := obj.(*unstructured.Unstructured)
+		em.Require().True(ok)
+
+		containers := w.Containers(u)
+		em.Require().Len(containers, 1, u.GetKind())
+		em.Equal([]interface{}{"--verbose"}, containers[0]["args"], u.GetKind())
+	}
+}
+
+func (em *EmbeddedManifestTest) TestContainerOverridesIgnoreUnregisteredWorkloads() {
+	em.AppendStage(config.Stage{
+		Name: "deploy log consumer",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			Files: []config.ManifestFile{
+				{
+					File: "testdata/pod-workloads.yml",
+				},
+			},
+			ContainerOverrides: []*config.ContainerOverrides{{Name: "agent", Args: []string{"--verbose"}}},
+		},
+	})
+
+	pipeline, err := em.Builder().Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	stg, ok := pipeline.Stages[0].(*types.ManifestStage)
+	em.Require().True(ok)
+
+	worker, ok := stg.Manifests[3].(*unstructured.Unstructured)
+	em.Require().True(ok)
+
+	containers, _, _ := unstructured.NestedSlice(worker.Object, "spec", "podTemplate", "spec", "containers")
+	em.Require().Len(containers, 1)
+	em.NotContains(containers[0], "args")
+}
+
+func (em *EmbeddedManifestTest) TestKustomizeOverlaysUseTheStageEnvironment() {
+	em.AppendStage(config.Stage{
+		Name:    "deploy web",
+		Account: "int-k8s",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			KustomizeDirs: []config.KustomizeDir{
+				{
+					Dir:      "kustomize/base",
+					Overlays: map[string]string{"int": "kustomize/overlays/int"},
+				},
+			},
+		},
+	})
+
+	pipeline, err := em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	stg, ok := pipeline.Stages[0].(*types.ManifestStage)
+	em.Require().True(ok)
+	em.Require().Len(stg.Manifests, 3)
+
+	for _, obj := range stg.Manifests {
+		u, ok := obj.(*unstructured.Unstructured)
+		em.Require().True(ok)
+		em.Equal("web-int", u.GetNamespace(), u.GetKind())
+	}
+}
+
+func (em *EmbeddedManifestTest) TestKustomizeNeedsAKustomizationForTheEnvironment() {
+	em.AppendStage(config.Stage{
+		Name:    "deploy web",
+		Account: "production-k8s",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			KustomizeDirs: []config.KustomizeDir{
+				{
+					Overlays: map[string]string{"int": "kustomize/overlays/int"},
+				},
+			},
+		},
+	})
+
+	_, err := em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), builder.ErrNoKustomization.Error())
+	em.Contains(err.Error(), "env production")
+}
+
+func (em *EmbeddedManifestTest) TestKustomizeErrorsNameTheOverlayAndResource() {
+	em.AppendStage(config.Stage{
+		Name: "deploy web",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			KustomizeDirs: []config.KustomizeDir{{Dir: "kustomize/broken"}},
+		},
+	})
+
+	_, err := em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), "kustomize overlay testdata/kustomize/broken")
+	em.Contains(err.Error(), "accumulating resources from 'worker.yaml'")
+	em.Contains(err.Error(), "web-worker")
+}
+
+func (em *EmbeddedManifestTest) TestHelmChartsAreTemplated() {
+	em.AppendStage(config.Stage{
+		Name: "deploy web",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			HelmCharts: []config.HelmChart{
+				{
+					Chart:       "charts/web",
+					ReleaseName: "web-canary",
+					Namespace:   "web",
+					ValuesFiles: []string{"charts/web-int.yml"},
+					Values: map[string]interface{}{
+						"image": map[interface{}]interface{}{"tag": "v2.0.0"},
+					},
+				},
+			},
+		},
+	})
+
+	pipeline, err := em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	stg, ok := pipeline.Stages[0].(*types.ManifestStage)
+	em.Require().True(ok)
+	em.Require().Len(stg.Manifests, 2, "hooks are not deployed")
+
+	deploy, ok := stg.Manifests[1].(*unstructured.Unstructured)
+	em.Require().True(ok)
+	em.Equal("web-canary", deploy.GetName())
+	em.Equal("web", deploy.GetNamespace())
+
+	containers, _, _ := unstructured.NestedSlice(deploy.Object, "spec", "template", "spec", "containers")
+	em.Require().Len(containers, 1)
+	em.Equal("registry.namely.land/namely/web:v2.0.0", containers[0].(map[string]interface{})["image"])
+}
+
+func (em *EmbeddedManifestTest) TestHelmChartsCanBeBaked() {
+	em.AppendStage(config.Stage{
+		Name: "bake web",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			HelmCharts: []config.HelmChart{
+				{
+					Chart:       "charts/web",
+					ReleaseName: "web",
+					Namespace:   "web",
+					Values: map[string]interface{}{
+						"image":  map[interface{}]interface{}{"tag": "v2.0.0"},
+						"hosts":  []interface{}{"web.namely.land"},
+						"labels": map[interface{}]interface{}{"app.kubernetes.io/name": "web"},
+						"args":   "--origins=a,b",
+					},
+					Bake: "HELM2",
+				},
+			},
+		},
+	})
+	em.AppendStage(config.Stage{
+		Name:                    "deploy web",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{ManifestArtifactID: "web"},
+	})
+
+	pipeline, err := em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	stg, ok := pipeline.Stages[0].(*types.BakeManifestStage)
+	em.Require().True(ok)
+	em.Equal("bakeManifest", stg.Type)
+	em.Equal("HELM2", stg.TemplateRenderer)
+	em.Empty(stg.Overrides)
+	em.Require().Len(stg.InputArtifacts, 2)
+
+	values, err := base64.StdEncoding.DecodeString(stg.InputArtifacts[1].Artifact.Reference)
+	em.Require().NoError(err)
+	em.Equal("web-values.yml", stg.InputArtifacts[1].Artifact.Name)
+	em.YAMLEq(`
+args: --origins=a,b
+hosts: [web.namely.land]
+image: {tag: v2.0.0}
+labels: {app.kubernetes.io/name: web}
+`, string(values), "inline values are embedded without the escaping of --set")
+
+	archive, err := base64.StdEncoding.DecodeString(stg.InputArtifacts[0].Artifact.Reference)
+	em.Require().NoError(err)
+
+	ch, err := loader.LoadArchive(bytes.NewReader(archive))
+	em.Require().NoError(err, "the embedded chart is a valid chart archive")
+	em.Equal("web", ch.Name())
+	em.Len(ch.Templates, 5)
+}
+
+func (em *EmbeddedManifestTest) TestHelmBakeCannotDeployOtherManifests() {
+	em.AppendStage(config.Stage{
+		Name: "bake web",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			Files:      []config.ManifestFile{{File: "nginx-deployment.yml"}},
+			HelmCharts: []config.HelmChart{{Chart: "charts/web", ReleaseName: "web", Bake: "HELM3"}},
+		},
+	})
+	em.AppendStage(config.Stage{
+		Name:                    "deploy web",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{ManifestArtifactID: "web"},
+	})
+
+	_, err := em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), builder.ErrBakeWithManifests.Error())
+}
+
+func (em *EmbeddedManifestTest) TestHelmBakeNeedsADeploy() {
+	em.AppendStage(config.Stage{
+		Name: "bake web",
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			HelmCharts: []config.HelmChart{{Chart: "charts/web", ReleaseName: "web", Bake: "HELM3"}},
+		},
+	})
+
+	_, err := em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().Error(err, "the bake alone deploys nothing")
+	em.Contains(err.Error(), builder.ErrBakedChartNotDeployed.Error())
+}
+
+// AppendIntOverlayStage deploys a kustomize dir that only has an overlay for the int environment
+func (em *EmbeddedManifestTest) AppendIntOverlayStage(account string) {
+	em.AppendStage(config.Stage{
+		Name:    "deploy web",
+		Account: account,
+		DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+			KustomizeDirs: []config.KustomizeDir{
+				{
+					Overlays: map[string]string{"int": "kustomize/overlays/int"},
+				},
+			},
+		},
+	})
+}
+
+func (em *EmbeddedManifestTest) TestEnvironmentMapMatchesAccountGlobs() {
+	em.AppendIntOverlayStage("qa-east-k8s")
+
+	envs := config.Environments{Accounts: []config.AccountEnvironment{{Account: "qa-*", Environment: "int"}}}
+	_, err := builder.New(em.pipeline, builder.WithBasePath("testdata"), builder.WithEnvironmentMap(envs)).Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+}
+
+func (em *EmbeddedManifestTest) TestEnvironmentMapMatchesAccountRegexes() {
+	em.AppendIntOverlayStage("sandbox-12")
+	em.pipeline.Environments = &config.Environments{
+		Accounts: []config.AccountEnvironment{{Regex: "sandbox-[0-9]+", Environment: "int"}},
+	}
+
+	_, err := em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().NoError(err, "error building pipeline config")
+
+	em.pipeline.Stages[0].Account = "sandbox-12-east"
+	_, err = em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().Error(err, "the regex matches the whole account")
+	em.Contains(err.Error(), "env default")
+}
+
+func (em *EmbeddedManifestTest) TestPipelineEnvironmentsComeFirst() {
+	em.AppendIntOverlayStage("int-k8s")
+	em.pipeline.Environments = &config.Environments{
+		Accounts: []config.AccountEnvironment{{Account: "int-k8s", Environment: "production"}},
+	}
+
+	envs := config.Environments{Accounts: []config.AccountEnvironment{{Account: "int-k8s", Environment: "int"}}}
+	_, err := builder.New(em.pipeline, builder.WithBasePath("testdata"), builder.WithEnvironmentMap(envs)).Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), "env production")
+}
+
+func (em *EmbeddedManifestTest) TestEnvironmentMapReplacesTheBuiltInAccounts() {
+	em.AppendIntOverlayStage("int-k8s")
+
+	envs := config.Environments{Accounts: []config.AccountEnvironment{{Account: "qa-*", Environment: "int"}}}
+	_, err := builder.New(em.pipeline, builder.WithBasePath("testdata"), builder.WithEnvironmentMap(envs)).Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), "env default")
+}
+
+func (em *EmbeddedManifestTest) TestEnvironmentFallbackCanFail() {
+	em.AppendIntOverlayStage("production-k8s")
+
+	envs := config.Environments{
+		Accounts: []config.AccountEnvironment{{Account: "int-*", Environment: "int"}},
+		Fallback: config.FallbackError,
+	}
+	_, err := builder.New(em.pipeline, builder.WithBasePath("testdata"), builder.WithEnvironmentMap(envs)).Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), builder.ErrNoEnvironment.Error())
+	em.Contains(err.Error(), "account production-k8s")
+}
+
+func (em *EmbeddedManifestTest) TestInvalidPipelineEnvironments() {
+	em.AppendIntOverlayStage("int-k8s")
+	em.pipeline.Environments = &config.Environments{
+		Accounts: []config.AccountEnvironment{{Regex: "int-(", Environment: "int"}},
+	}
+
+	_, err := em.BuilderWithBasePath("testdata").Pipeline()
+	em.Require().Error(err)
+	em.Contains(err.Error(), "invalid account regex int-(")
+}
+
 func TestEmbeddedManifests(t *testing.T) {
 	em := &EmbeddedManifestTest{}
 	suite.Run(t, em)
@@ -0,0 +1,71 @@
+package builder
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+var (
+	// ErrNoEnvironment is returned when no environment matches the account of a stage and the fallback is error
+	ErrNoEnvironment = errors.New("builder: no environment matches the account")
+
+	// defaultEnvironments are used when neither the pipeline nor the builder
+	// options map any account, they are the accounts k8s-pipeliner always knew
+	defaultEnvironments = config.Environments{
+		Accounts: []config.AccountEnvironment{
+			{Regex: "int(-k8s)?", Environment: "int"},
+			{Regex: "staging(-k8s)?", Environment: "stage"},
+			{Regex: "production(-k8s)?", Environment: "production"},
+			{Regex: "ops(-k8s)?", Environment: "ops"},
+		},
+	}
+)
+
+// environments returns the environments accounts are looked up in, the
+// environments of the pipeline come before the ones of the builder options
+func (b *Builder) environments() []config.Environments {
+	var envs []config.Environments
+	if b.pipeline.Environments != nil {
+		envs = append(envs, *b.pipeline.Environments)
+	}
+	envs = append(envs, b.environmentMaps...)
+
+	if len(envs) == 0 {
+		return []config.Environments{defaultEnvironments}
+	}
+
+	return envs
+}
+
+// stageEnvironment returns the environment an account deploys to, an env set
+// on the manifest source takes precedence
+func (b *Builder) stageEnvironment(account, env string) (string, error) {
+	if env != "" {
+		return env, nil
+	}
+
+	envs := b.environments()
+	for _, e := range envs {
+		for _, ae := range e.Accounts {
+			ok, err := ae.Matches(account)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				return ae.Environment, nil
+			}
+		}
+	}
+
+	for _, e := range envs {
+		if e.Fallback == config.FallbackError {
+			return "", errors.Wrapf(ErrNoEnvironment, "account %s", account)
+		}
+		if e.Fallback != "" {
+			break
+		}
+	}
+
+	return config.FallbackDefault, nil
+}
@@ -0,0 +1,346 @@
+package builder
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/namely/k8s-pipeliner/pipeline/remote"
+)
+
+var (
+	// ErrPathOutsideRoot is returned when a file of the pipeline config resolves to a path outside of the root path
+	ErrPathOutsideRoot = errors.New("builder: path is outside of the root path")
+	// ErrNoRemote is returned for remote references of the pipeline config when the builder has no fetcher set with WithRemote
+	ErrNoRemote = errors.New("builder: remote references need a fetcher set with WithRemote")
+)
+
+// files opens the files a pipeline config references. Without a file system
+// they are read from disk, with one they are read from it with slash
+// separated paths. Relative paths are resolved against the base path, and
+// must stay within the root path or the file system. Remote references are
+// fetched with the remote fetcher, there is none by default.
+type files struct {
+	fsys     fs.FS
+	basePath string
+	rootPath string
+	remote   *remote.Fetcher
+}
+
+// path resolves a file of the pipeline config against the base path
+func (f files) path(file string) (string, error) {
+	if f.fsys != nil {
+		if !path.IsAbs(file) {
+			file = path.Join(f.basePath, file)
+		}
+
+		resolved := strings.TrimPrefix(path.Clean(file), "/")
+		if resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return "", errors.Wrap(ErrPathOutsideRoot, file)
+		}
+		return resolved, nil
+	}
+
+	if !filepath.IsAbs(file) && f.basePath != "" {
+		file = filepath.Join(f.basePath, file)
+	}
+	if f.rootPath == "" {
+		return file, nil
+	}
+
+	// symlinks are resolved so a link in the root can't point outside of it
+	root, err := realPath(f.rootPath)
+	if err != nil {
+		return "", err
+	}
+	abs, err := realPath(file)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Wrapf(ErrPathOutsideRoot, "%s is not in %s", file, f.rootPath)
+	}
+
+	return file, nil
+}
+
+// realPath returns the absolute path of a file with its symlinks resolved, for
+// a file that doesn't exist the symlinks of its closest existing parent are
+func realPath(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	parent := filepath.Dir(abs)
+	if parent == abs {
+		return abs, nil
+	}
+	dir, err := realPath(parent)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.Base(abs)), nil
+}
+
+// Path returns where a file of the pipeline config is read from, remote
+// references are returned as they are
+func (f files) Path(file string) (string, error) {
+	if remote.IsRemote(file) {
+		return file, nil
+	}
+
+	return f.path(file)
+}
+
+// ReadFile returns the content of a file of the pipeline config
+func (f files) ReadFile(file string) ([]byte, error) {
+	if remote.IsRemote(file) {
+		if f.remote == nil {
+			return nil, errors.Wrap(ErrNoRemote, file)
+		}
+		return f.remote.Fetch(file)
+	}
+
+	resolved, err := f.path(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.fsys != nil {
+		return fs.ReadFile(f.fsys, resolved)
+	}
+
+	return os.ReadFile(resolved)
+}
+
+// files returns the files of the pipeline config the builder reads
+func (b *Builder) files() files {
+	return files{fsys: b.fsys, basePath: b.basePath, rootPath: b.rootPath, remote: b.remote}
+}
+
+// NewFileReader returns the reader of the files of a builder with opts, so
+// the files a pipeline file includes are read like its manifests, ie:
+// config.NewPipeline(r, config.WithFiles(builder.NewFileReader(opts...)))
+func NewFileReader(opts ...OptFunc) config.FileReader {
+	return New(nil, opts...).files()
+}
+
+// path resolves a file of the pipeline config against the base path of the builder
+func (b *Builder) path(file string) (string, error) {
+	return b.files().path(file)
+}
+
+// manifestParser returns a manifest parser that reads from the files of the builder
+func (b *Builder) manifestParser() *ManifestParser {
+	return &ManifestParser{config: b.pipeline, files: b.files()}
+}
+
+// loadChart loads a chart directory or archive
+func (b *Builder) loadChart(name string) (*chart.Chart, error) {
+	root, err := b.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.fsys == nil {
+		return loader.Load(root)
+	}
+
+	info, err := fs.Stat(b.fsys, root)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		content, err := fs.ReadFile(b.fsys, root)
+		if err != nil {
+			return nil, err
+		}
+		return loader.LoadArchive(bytes.NewReader(content))
+	}
+
+	var chartFiles []*loader.BufferedFile
+	err = fs.WalkDir(b.fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(b.fsys, p)
+		if err != nil {
+			return err
+		}
+		chartFiles = append(chartFiles, &loader.BufferedFile{Name: strings.TrimPrefix(p, root+"/"), Data: content})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return loader.LoadFiles(chartFiles)
+}
+
+// kustomizeFS returns the file system kustomize reads from and the path of a
+// kustomization in it. With a file system, kustomize reads the files it needs
+// from it on demand.
+func (b *Builder) kustomizeFS(dir string) (filesys.FileSystem, string, error) {
+	resolved, err := b.path(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if b.fsys == nil {
+		return filesys.MakeFsOnDisk(), resolved, nil
+	}
+
+	return kustomizeFiles{fsys: b.fsys}, path.Join("/", resolved), nil
+}
+
+// kustomizeFiles is a read only kustomize file system over an fs.FS, its
+// paths are absolute slash separated paths from the root of the fs.FS
+type kustomizeFiles struct {
+	fsys fs.FS
+}
+
+// name returns the fs.FS name of a kustomize path
+func (k kustomizeFiles) name(p string) string {
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		return "."
+	}
+
+	return name
+}
+
+func (k kustomizeFiles) readOnly(op, p string) error {
+	return &fs.PathError{Op: op, Path: p, Err: fs.ErrPermission}
+}
+
+func (k kustomizeFiles) Create(p string) (filesys.File, error) {
+	return nil, k.readOnly("create", p)
+}
+
+func (k kustomizeFiles) Mkdir(p string) error {
+	return k.readOnly("mkdir", p)
+}
+
+func (k kustomizeFiles) MkdirAll(p string) error {
+	return k.readOnly("mkdir", p)
+}
+
+func (k kustomizeFiles) RemoveAll(p string) error {
+	return k.readOnly("remove", p)
+}
+
+func (k kustomizeFiles) WriteFile(p string, _ []byte) error {
+	return k.readOnly("write", p)
+}
+
+func (k kustomizeFiles) Open(p string) (filesys.File, error) {
+	f, err := k.fsys.Open(k.name(p))
+	if err != nil {
+		return nil, err
+	}
+
+	return kustomizeFile{File: f, name: p}, nil
+}
+
+func (k kustomizeFiles) IsDir(p string) bool {
+	info, err := fs.Stat(k.fsys, k.name(p))
+	return err == nil && info.IsDir()
+}
+
+func (k kustomizeFiles) ReadDir(p string) ([]string, error) {
+	entries, err := fs.ReadDir(k.fsys, k.name(p))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, nil
+}
+
+func (k kustomizeFiles) CleanedAbs(p string) (filesys.ConfirmedDir, string, error) {
+	abs := path.Join("/", k.name(p))
+	info, err := fs.Stat(k.fsys, k.name(p))
+	if err != nil {
+		return "", "", err
+	}
+	if info.IsDir() {
+		return filesys.ConfirmedDir(abs), "", nil
+	}
+
+	return filesys.ConfirmedDir(path.Dir(abs)), path.Base(abs), nil
+}
+
+func (k kustomizeFiles) Exists(p string) bool {
+	_, err := fs.Stat(k.fsys, k.name(p))
+	return err == nil
+}
+
+func (k kustomizeFiles) Glob(pattern string) ([]string, error) {
+	matches, err := fs.Glob(k.fsys, k.name(pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, m := range matches {
+		if !k.IsDir(m) {
+			files = append(files, path.Join("/", m))
+		}
+	}
+	if filesys.IsHiddenFilePath(pattern) {
+		return files, nil
+	}
+
+	return filesys.RemoveHiddenFiles(files), nil
+}
+
+func (k kustomizeFiles) ReadFile(p string) ([]byte, error) {
+	return fs.ReadFile(k.fsys, k.name(p))
+}
+
+func (k kustomizeFiles) Walk(p string, walkFn filepath.WalkFunc) error {
+	return fs.WalkDir(k.fsys, k.name(p), func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return walkFn(path.Join("/", name), nil, err)
+		}
+
+		info, err := d.Info()
+		return walkFn(path.Join("/", name), info, err)
+	})
+}
+
+// kustomizeFile is a read only file of kustomizeFiles
+type kustomizeFile struct {
+	fs.File
+	name string
+}
+
+func (f kustomizeFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
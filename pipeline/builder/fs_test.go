@@ -0,0 +1,284 @@
+package builder_test
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder"
+	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/namely/k8s-pipeliner/pipeline/remote"
+)
+
+// testdataFS copies testdata files into an in memory file system, keyed by
+// their path in it
+func testdataFS(t *testing.T, files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, source := range files {
+		err := filepath.WalkDir(source, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			content, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(source, p)
+			if err != nil {
+				return err
+			}
+			fsys[path.Join(name, filepath.ToSlash(rel))] = &fstest.MapFile{Data: content}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	return fsys
+}
+
+// openLog is a file system that records the names of the files it opens
+type openLog struct {
+	fs.FS
+	names []string
+}
+
+func (o *openLog) Open(name string) (fs.File, error) {
+	o.names = append(o.names, name)
+	return o.FS.Open(name)
+}
+
+func TestBuilderFS(t *testing.T) {
+	fsys := testdataFS(t, map[string]string{
+		"services/web/deployment.yml":   "testdata/nginx-deployment.yml",
+		"services/web/configurator.yml": "testdata/configurator.yml",
+		"services/web/podspec.yml":      "testdata/podspec.yml",
+		"services/web/chart":            "testdata/charts/web",
+		"kustomize":                     "testdata/kustomize",
+	})
+
+	build := func(stage config.Stage) (*types.SpinnakerPipeline, error) {
+		p := &config.Pipeline{Name: "Deploy", Application: "web", Stages: []config.Stage{stage}}
+		return builder.New(p, builder.WithFS(fsys, "services/web/pipeline.yml")).Pipeline()
+	}
+
+	t.Run("Embedded manifests are read relative to the pipeline file", func(t *testing.T) {
+		pipeline, err := build(config.Stage{
+			Name:    "Deploy",
+			Account: "int-k8s",
+			DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+				Files:             []config.ManifestFile{{File: "deployment.yml"}},
+				ConfiguratorFiles: []config.ManifestFile{{File: "configurator.yml"}},
+				KustomizeDirs:     []config.KustomizeDir{{Overlays: map[string]string{"int": "../../kustomize/overlays/int"}}},
+				HelmCharts:        []config.HelmChart{{Chart: "chart", ReleaseName: "web"}},
+			},
+		})
+		require.NoError(t, err)
+
+		ms := pipeline.Stages[0].(*types.ManifestStage)
+		var kinds []string
+		for _, obj := range ms.Manifests {
+			kinds = append(kinds, obj.(*unstructured.Unstructured).GetKind())
+		}
+		assert.Equal(t, []string{"Deployment", "ConfigMap", "Deployment", "Service", "ConfigMap", "Service", "Deployment"}, kinds, "files, configurator files, the kustomization and the chart")
+	})
+
+	t.Run("Absolute paths are relative to the root of the file system", func(t *testing.T) {
+		_, err := build(config.Stage{
+			Name:                    "Deploy",
+			Account:                 "int-k8s",
+			DeployEmbeddedManifests: &config.DeployEmbeddedManifests{KustomizeDirs: []config.KustomizeDir{{Dir: "/kustomize/worker"}}},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("Deploy groups read their manifest from the file system", func(t *testing.T) {
+		pipeline, err := build(config.Stage{
+			Name:    "Deploy",
+			Account: "int-k8s",
+			Deploy: &config.DeployStage{
+				Groups: []config.Group{{ManifestFile: "podspec.yml", Stack: "web"}},
+			},
+		})
+		require.NoError(t, err)
+
+		ds := pipeline.Stages[0].(*types.DeployStage)
+		require.Len(t, ds.Clusters, 1)
+		assert.NotEmpty(t, ds.Clusters[0].Containers)
+	})
+
+	t.Run("Kustomize only reads the files of the kustomization", func(t *testing.T) {
+		opened := &openLog{FS: fsys}
+		p := &config.Pipeline{Name: "Deploy", Application: "web", Stages: []config.Stage{{
+			Name:                    "Deploy",
+			Account:                 "int-k8s",
+			DeployEmbeddedManifests: &config.DeployEmbeddedManifests{KustomizeDirs: []config.KustomizeDir{{Dir: "/kustomize/overlays/int"}}},
+		}}}
+
+		_, err := builder.New(p, builder.WithFS(opened, "services/web/pipeline.yml")).Pipeline()
+		require.NoError(t, err)
+
+		assert.Contains(t, opened.names, "kustomize/base/deployment.yaml")
+		for _, name := range opened.names {
+			assert.False(t, strings.HasPrefix(name, "services/") || strings.HasPrefix(name, "kustomize/worker"), "%s is not part of the kustomization", name)
+		}
+	})
+
+	t.Run("Files outside of the file system are not read", func(t *testing.T) {
+		_, err := build(config.Stage{
+			Name:                    "Deploy",
+			DeployEmbeddedManifests: &config.DeployEmbeddedManifests{Files: []config.ManifestFile{{File: "../../../testdata/nginx-deployment.yml"}}},
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), builder.ErrPathOutsideRoot.Error())
+	})
+}
+
+func TestBuilderRootPath(t *testing.T) {
+	build := func(file string) error {
+		p := &config.Pipeline{Name: "Deploy", Application: "web", Stages: []config.Stage{{
+			Name:                    "Deploy",
+			DeployEmbeddedManifests: &config.DeployEmbeddedManifests{Files: []config.ManifestFile{{File: file}}},
+		}}}
+
+		_, err := builder.New(p, builder.WithBasePath("testdata/golden"), builder.WithRootPath("testdata")).Pipeline()
+		return err
+	}
+
+	t.Run("Paths within the root are read", func(t *testing.T) {
+		assert.NoError(t, build("../nginx-deployment.yml"))
+	})
+
+	t.Run("Relative paths escaping the root fail", func(t *testing.T) {
+		err := build("../../builder.go")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), builder.ErrPathOutsideRoot.Error())
+	})
+
+	t.Run("Absolute paths outside of the root fail", func(t *testing.T) {
+		abs, err := filepath.Abs("builder.go")
+		require.NoError(t, err)
+
+		err = build(abs)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), builder.ErrPathOutsideRoot.Error())
+	})
+
+	t.Run("Symlinks are resolved before comparing with the root", func(t *testing.T) {
+		outside, err := filepath.Abs("testdata/nginx-deployment.yml")
+		require.NoError(t, err)
+
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "repo"), 0755))
+		require.NoError(t, os.Symlink(outside, filepath.Join(dir, "repo", "escape.yml")))
+		content, err := os.ReadFile(outside)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "repo", "nginx.yml"), content, 0644))
+		require.NoError(t, os.Symlink(filepath.Join(dir, "repo"), filepath.Join(dir, "link")))
+
+		build := func(root, file string) error {
+			p := &config.Pipeline{Name: "Deploy", Application: "web", Stages: []config.Stage{{
+				Name:                    "Deploy",
+				DeployEmbeddedManifests: &config.DeployEmbeddedManifests{Files: []config.ManifestFile{{File: file}}},
+			}}}
+
+			_, err := builder.New(p, builder.WithBasePath(filepath.Join(dir, "repo")), builder.WithRootPath(root)).Pipeline()
+			return err
+		}
+
+		err = build(filepath.Join(dir, "repo"), "escape.yml")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), builder.ErrPathOutsideRoot.Error())
+
+		assert.NoError(t, build(filepath.Join(dir, "link"), "nginx.yml"), "a symlinked root contains the files of its target")
+	})
+}
+
+func TestBuilderRemoteManifests(t *testing.T) {
+	srv := httptest.NewTLSServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+
+	p := &config.Pipeline{Name: "Deploy", Application: "web", Stages: []config.Stage{
+		{
+			Name:                    "Deploy manifests",
+			Account:                 "int-k8s",
+			DeployEmbeddedManifests: &config.DeployEmbeddedManifests{Files: []config.ManifestFile{{File: srv.URL + "/nginx-deployment.yml"}}},
+		},
+		{
+			Name:    "Deploy group",
+			Account: "int-k8s",
+			Deploy:  &config.DeployStage{Groups: []config.Group{{ManifestFile: srv.URL + "/podspec.yml", Stack: "web"}}},
+		},
+	}}
+
+	_, err := builder.New(p).Pipeline()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), builder.ErrNoRemote.Error(), "nothing is fetched without a fetcher")
+
+	fetcher := remote.NewFetcher(remote.WithResolver(remote.HTTPS, &remote.HTTPResolver{Client: srv.Client()}))
+	pipeline, err := builder.New(p, builder.WithRootPath("testdata/golden"), builder.WithRemote(fetcher)).Pipeline()
+	require.NoError(t, err, "remote references are not paths of the root")
+
+	ms := pipeline.Stages[0].(*types.ManifestStage)
+	require.Len(t, ms.Manifests, 1)
+	assert.Equal(t, "Deployment", ms.Manifests[0].(*unstructured.Unstructured).GetKind())
+
+	ds := pipeline.Stages[1].(*types.DeployStage)
+	require.Len(t, ds.Clusters, 1)
+	assert.NotEmpty(t, ds.Clusters[0].Containers)
+}
+
+func TestFileReaderIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"services/web/pipeline.yml": &fstest.MapFile{Data: []byte("name: web\ninclude:\n  - ../../shared/deploy.yml\n")},
+		"services/api/pipeline.yml": &fstest.MapFile{Data: []byte("name: api\ninclude:\n  - ../../../deploy.yml\n")},
+		"shared/deploy.yml":         &fstest.MapFile{Data: []byte("stages:\n  - name: Deploy\n    manualJudgement: {}\n")},
+	}
+
+	decode := func(pipelineFile string) (*config.Pipeline, error) {
+		content, err := fsys.ReadFile(pipelineFile)
+		require.NoError(t, err)
+
+		files := builder.NewFileReader(builder.WithFS(fsys, pipelineFile))
+		return config.NewPipeline(bytes.NewReader(content), config.WithFilename(pipelineFile), config.WithFiles(files))
+	}
+
+	t.Run("Includes are read from the file system of the builder", func(t *testing.T) {
+		p, err := decode("services/web/pipeline.yml")
+		require.NoError(t, err)
+		require.Len(t, p.Stages, 1)
+		assert.Equal(t, "Deploy", p.Stages[0].Name)
+	})
+
+	t.Run("Includes outside of the file system are not read", func(t *testing.T) {
+		_, err := decode("services/api/pipeline.yml")
+		require.Error(t, err)
+		assert.Equal(t, builder.ErrPathOutsideRoot, errors.Cause(err))
+	})
+
+	t.Run("Includes outside of the root path are not read", func(t *testing.T) {
+		files := builder.NewFileReader(builder.WithBasePath("testdata/golden"), builder.WithRootPath("testdata/golden"))
+		_, err := config.NewPipeline(strings.NewReader("name: web\ninclude:\n  - ../configurator.yml\n"), config.WithFiles(files))
+		require.Error(t, err)
+		assert.Equal(t, builder.ErrPathOutsideRoot, errors.Cause(err))
+	})
+
+	t.Run("Remote includes need a fetcher", func(t *testing.T) {
+		_, err := config.NewPipeline(strings.NewReader("name: web\ninclude:\n  - https://example.com/deploy.yml\n"), config.WithFiles(builder.NewFileReader()))
+		assert.Equal(t, builder.ErrNoRemote, errors.Cause(err))
+	})
+}
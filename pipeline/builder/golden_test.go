@@ -0,0 +1,319 @@
+package builder_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+// update regenerates the golden files, run it with:
+//
+//	go test ./pipeline/builder -run TestGolden -update
+var update = flag.Bool("update", false, "regenerate the golden JSON files in testdata/golden")
+
+// droppedOptions lists the stage options that are accepted in a pipeline.yml
+// but have no effect on the generated JSON. Every entry needs a reason, and
+// an option that starts changing the output must be removed from this list.
+// An entry also covers every option nested below it.
+var droppedOptions = map[string]string{
+	"runJob.deleteJob":                                           "not supported by the run job stage yet",
+	"deploy.groups.containerOverrides.name":                      "deploy groups only allow a single container",
+	"deploy.groups.containerOverrides.resources.requests.cpu":    "resources are only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.resources.requests.memory": "resources are only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.resources.limits.cpu":      "resources are only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.resources.limits.memory":   "resources are only overridden for embedded manifests",
+	"deployEmbeddedManifests.files.env":                          "environments only apply to configurator files",
+	"deploy.groups.containerOverrides.image":                     "only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.imagePullPolicy":           "only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.env":                       "only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.removeEnv":                 "only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.envFrom":                   "only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.livenessProbe":             "only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.readinessProbe":            "only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.startupProbe":              "only overridden for embedded manifests",
+	"deploy.groups.containerOverrides.volumeMounts":              "only overridden for embedded manifests",
+	"jenkins.type":   "the stage type is always jenkins",
+	"spinnaker.type": "the stage type is always pipeline",
+	"spinnaker.job":  "run pipeline stages do not have a job",
+}
+
+const goldenDir = "testdata/golden"
+
+// TestGoldenPipelines builds every pipeline fixture in testdata/golden and
+// compares it with the checked in JSON next to it
+func TestGoldenPipelines(t *testing.T) {
+	for _, fixture := range goldenFixtures(t) {
+		fixture := fixture
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			content, err := ioutil.ReadFile(fixture)
+			require.NoError(t, err)
+
+			out, err := buildGolden(content)
+			require.NoError(t, err, "error building pipeline fixture")
+
+			golden := strings.TrimSuffix(fixture, ".yml") + ".json"
+			if *update {
+				require.NoError(t, ioutil.WriteFile(golden, out, 0644))
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			require.NoError(t, err, "missing golden file, run the tests with -update to create it")
+			assert.Equal(t, string(expected), string(out), "generated JSON differs from %s, run the tests with -update if this is expected", golden)
+		})
+	}
+}
+
+// TestGoldenOptionsAreNotDropped changes every stage option in the fixtures one
+// at a time and makes sure the generated JSON changes (or the build fails)
+func TestGoldenOptionsAreNotDropped(t *testing.T) {
+	seen := make(map[string]bool)
+	changed := make(map[string]bool)
+
+	for _, fixture := range goldenFixtures(t) {
+		content, err := ioutil.ReadFile(fixture)
+		require.NoError(t, err)
+
+		baseline, err := buildGolden(content)
+		require.NoError(t, err)
+
+		var doc map[interface{}]interface{}
+		require.NoError(t, yaml.Unmarshal(content, &doc))
+
+		for _, opt := range stageOptions(doc) {
+			seen[opt.path] = true
+
+			opt.set(mutate(opt.value))
+			mutated, err := yaml.Marshal(doc)
+			require.NoError(t, err)
+			opt.set(opt.value)
+
+			out, err := buildGolden(mutated)
+			if err != nil || !bytes.Equal(out, baseline) {
+				changed[opt.path] = true
+			}
+		}
+	}
+
+	for path := range seen {
+		if dropped(path) {
+			assert.False(t, changed[path], "%s changes the generated JSON, remove it from droppedOptions", path)
+			continue
+		}
+		assert.True(t, changed[path], "%s does not change the generated JSON", path)
+	}
+}
+
+// TestGoldenFixturesCoverEveryOption makes sure every option of every stage
+// type is set by at least one fixture, so new options get golden coverage
+func TestGoldenFixturesCoverEveryOption(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, fixture := range goldenFixtures(t) {
+		content, err := ioutil.ReadFile(fixture)
+		require.NoError(t, err)
+
+		var doc map[interface{}]interface{}
+		require.NoError(t, yaml.Unmarshal(content, &doc))
+
+		for _, opt := range stageOptions(doc) {
+			seen[opt.path] = true
+		}
+	}
+
+	var missing []string
+	for _, path := range optionPaths() {
+		if !seen[path] {
+			missing = append(missing, path)
+		}
+	}
+
+	assert.Empty(t, missing, "stage options without a fixture in %s", goldenDir)
+}
+
+// dropped returns whether an option or one of its parents is in droppedOptions
+func dropped(path string) bool {
+	for p := path; p != ""; p = p[:max(strings.LastIndex(p, "."), 0)] {
+		if _, ok := droppedOptions[p]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func goldenFixtures(t *testing.T) []string {
+	fixtures, err := filepath.Glob(filepath.Join(goldenDir, "*.yml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, fixtures)
+
+	return fixtures
+}
+
+// buildGolden builds a pipeline.yml with the manifests in testdata and returns
+// the indented JSON
+func buildGolden(content []byte) ([]byte, error) {
+	p, err := config.NewPipeline(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := builder.New(p, builder.WithBasePath("testdata")).MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, out, "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil
+}
+
+type option struct {
+	path  string
+	value interface{}
+	set   func(interface{})
+}
+
+// stageOptions returns every scalar value set on a stage type in a decoded
+// pipeline.yml, with its path (ie: deploy.groups.targetSize)
+func stageOptions(doc map[interface{}]interface{}) []option {
+	var opts []option
+
+	stages, _ := doc["stages"].([]interface{})
+	for _, s := range stages {
+		stage, ok := s.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, f := range stageTypes() {
+			key := yamlKey(f)
+			if v, ok := stage[key]; ok {
+				opts = append(opts, options(key, v, f.Type, nil)...)
+			}
+		}
+	}
+
+	sort.Slice(opts, func(i, j int) bool { return opts[i].path < opts[j].path })
+	return opts
+}
+
+func options(path string, v interface{}, t reflect.Type, set func(interface{})) []option {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var opts []option
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			key := yamlKey(f)
+			if _, ok := m[key]; !ok {
+				continue
+			}
+			opts = append(opts, options(path+"."+key, m[key], f.Type, func(nv interface{}) { m[key] = nv })...)
+		}
+	case reflect.Slice:
+		list, _ := v.([]interface{})
+		for i := range list {
+			i := i
+			opts = append(opts, options(path, list[i], t.Elem(), func(nv interface{}) { list[i] = nv })...)
+		}
+	case reflect.Map:
+		m, _ := v.(map[interface{}]interface{})
+		for k := range m {
+			k := k
+			opts = append(opts, options(path, m[k], t.Elem(), func(nv interface{}) { m[k] = nv })...)
+		}
+	default:
+		opts = append(opts, option{path: path, value: v, set: set})
+	}
+
+	return opts
+}
+
+// optionPaths returns the path of every scalar option of every stage type
+func optionPaths() []string {
+	var paths []string
+	var walk func(path string, t reflect.Type)
+	walk = func(path string, t reflect.Type) {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			paths = append(paths, path)
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			walk(path+"."+yamlKey(t.Field(i)), t.Field(i).Type)
+		}
+	}
+
+	for _, f := range stageTypes() {
+		walk(yamlKey(f), f.Type)
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// stageTypes returns the fields of config.Stage that define the stage type
+func stageTypes() []reflect.StructField {
+	var fields []reflect.StructField
+
+	t := reflect.TypeOf(config.Stage{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+func yamlKey(f reflect.StructField) string {
+	key := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if key == "" {
+		return strings.ToLower(f.Name)
+	}
+
+	return key
+}
+
+func mutate(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bool:
+		return !t
+	case int:
+		return t + 1
+	case string:
+		if n, err := strconv.Atoi(t); err == nil {
+			return strconv.Itoa(n + 1)
+		}
+		return t + "-mutated"
+	}
+
+	return v
+}
@@ -0,0 +1,252 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+const (
+	// EmbeddedArtifact is the spinnaker artifact type of base64 encoded content in the pipeline
+	EmbeddedArtifact = "embedded/base64"
+
+	embeddedArtifactAccount = "embedded-artifact"
+)
+
+var (
+	// ErrBakeWithManifests is returned when a stage bakes a helm chart and deploys other manifests
+	ErrBakeWithManifests = errors.New("builder: a stage that bakes a helm chart can not deploy other manifests")
+	// ErrBakedChartNotDeployed is returned when a stage bakes a helm chart and no stage deploys the baked manifest
+	ErrBakedChartNotDeployed = errors.New("builder: no stage deploys the baked helm chart, set manifestArtifactId to its releaseName on a deployEmbeddedManifests stage")
+
+	helmRenderers = map[string]bool{"HELM2": true, "HELM3": true}
+)
+
+// helmManifests templates a local chart like helm template does, without
+// access to a cluster. Hooks and NOTES.txt are not part of the manifests.
+func (b *Builder) helmManifests(hc config.HelmChart) ([]runtime.Object, error) {
+	ch, err := b.loadChart(hc.Chart)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load helm chart %s", hc.Chart)
+	}
+
+	vals, err := b.helmValues(hc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := chartutil.ProcessDependencies(ch, vals); err != nil {
+		return nil, errors.Wrapf(err, "could not process the dependencies of helm chart %s", hc.Chart)
+	}
+
+	options := chartutil.ReleaseOptions{Name: hc.ReleaseName, Namespace: hc.Namespace, Revision: 1, IsInstall: true}
+	renderVals, err := chartutil.ToRenderValues(ch, vals, options, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid values for helm chart %s", hc.Chart)
+	}
+
+	files, err := engine.Render(ch, renderVals)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not render helm chart %s", hc.Chart)
+	}
+	for name := range files {
+		if strings.HasSuffix(name, "NOTES.txt") {
+			delete(files, name)
+		}
+	}
+
+	_, manifests, err := releaseutil.SortManifests(files, chartutil.DefaultCapabilities.APIVersions, releaseutil.InstallOrder)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not sort the manifests of helm chart %s", hc.Chart)
+	}
+
+	var buf bytes.Buffer
+	for _, m := range manifests {
+		fmt.Fprintf(&buf, "---\n%s\n", m.Content)
+	}
+
+	objs, err := decodeManifests(&buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decode the manifests of helm chart %s", hc.Chart)
+	}
+
+	return objs, nil
+}
+
+// helmValues merges the values files and inline values of a chart, later values win
+func (b *Builder) helmValues(hc config.HelmChart) (chartutil.Values, error) {
+	vals := chartutil.Values{}
+	for _, file := range hc.ValuesFiles {
+		content, err := b.files().ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read values file %s", file)
+		}
+		fileVals, err := chartutil.ReadValues(content)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read values file %s", file)
+		}
+		vals = chartutil.CoalesceTables(fileVals, vals)
+	}
+
+	inline, err := inlineValues(hc.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	return chartutil.CoalesceTables(inline, vals), nil
+}
+
+// inlineValues converts the values of a pipeline config, which are decoded
+// with interface keys, to the values helm renders with
+func inlineValues(values map[string]interface{}) (chartutil.Values, error) {
+	out, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not encode inline helm values")
+	}
+
+	return chartutil.ReadValues(out)
+}
+
+// buildHelmBakeStage emits a bakeManifest stage that renders the helm chart of
+// an embedded manifest stage inside spinnaker. The chart, the values files and
+// the inline values are embedded as base64 artifacts, so the values keep their
+// types and don't need the escaping of helm --set overrides.
+func (b *Builder) buildHelmBakeStage(index int, s config.Stage) (*types.BakeManifestStage, error) {
+	ms := s.DeployEmbeddedManifests
+	if len(ms.HelmCharts) != 1 || len(ms.Files)+len(ms.ConfiguratorFiles)+len(ms.KustomizeDirs) > 0 ||
+		ms.ManifestArtifactID != "" || len(ms.ContainerOverrides)+len(ms.ImageDescriptions) > 0 {
+		return nil, ErrBakeWithManifests
+	}
+
+	hc := ms.HelmCharts[0]
+	if !helmRenderers[hc.Bake] {
+		return nil, errors.Wrap(ErrUnknownTemplateRenderer, hc.Bake)
+	}
+
+	ch, err := b.loadChart(hc.Chart)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load helm chart %s", hc.Chart)
+	}
+
+	archive, err := chartArchive(ch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not package helm chart %s", hc.Chart)
+	}
+
+	inputs := []types.InputArtifact{embeddedArtifact(ch.Name()+"-"+ch.Metadata.Version+".tgz", archive)}
+	for _, file := range hc.ValuesFiles {
+		content, err := b.files().ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read values file %s", file)
+		}
+		inputs = append(inputs, embeddedArtifact(path.Base(file), content))
+	}
+
+	if len(hc.Values) > 0 {
+		inline, err := inlineValues(hc.Values)
+		if err != nil {
+			return nil, err
+		}
+		content, err := inline.YAML()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not encode inline helm values")
+		}
+		inputs = append(inputs, embeddedArtifact(hc.ReleaseName+"-values.yml", []byte(content)))
+	}
+
+	return &types.BakeManifestStage{
+		StageMetadata:     buildStageMetadata(s, "bakeManifest", index, b.isLinear),
+		TemplateRenderer:  hc.Bake,
+		OutputName:        hc.ReleaseName,
+		Namespace:         hc.Namespace,
+		InputArtifacts:    inputs,
+		Overrides:         map[string]string{},
+		ExpectedArtifacts: []types.ExpectedArtifact{bakedArtifact(hc.ReleaseName)},
+	}, nil
+}
+
+// checkBakedChartsDeployed fails for stages that bake a helm chart when no
+// stage deploys the baked manifest, since the bake alone deploys nothing
+func checkBakedChartsDeployed(stages []config.Stage) error {
+	deployed := make(map[string]bool)
+	for _, s := range stages {
+		if s.DeployEmbeddedManifests != nil && s.DeployEmbeddedManifests.ManifestArtifactID != "" {
+			deployed[s.DeployEmbeddedManifests.ManifestArtifactID] = true
+		}
+	}
+
+	for _, s := range stages {
+		if s.DeployEmbeddedManifests == nil {
+			continue
+		}
+		for _, hc := range s.DeployEmbeddedManifests.HelmCharts {
+			if hc.Bake != "" && !deployed[hc.ReleaseName] {
+				return errors.Wrapf(ErrBakedChartNotDeployed, "stage %s bakes %s", s.Name, hc.ReleaseName)
+			}
+		}
+	}
+
+	return nil
+}
+
+func embeddedArtifact(name string, content []byte) types.InputArtifact {
+	return types.InputArtifact{
+		Account: embeddedArtifactAccount,
+		Artifact: &types.Artifact{
+			ArtifactAccount: embeddedArtifactAccount,
+			Type:            EmbeddedArtifact,
+			Name:            name,
+			Reference:       base64.StdEncoding.EncodeToString(content),
+		},
+	}
+}
+
+// chartArchive packages the files of a chart like helm package, without
+// timestamps so the same chart always produces the same pipeline
+func chartArchive(ch *chart.Chart) ([]byte, error) {
+	files := append([]*chart.File{}, ch.Raw...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:     path.Join(ch.Name(), f.Name),
+			Mode:     0644,
+			Size:     int64(len(f.Data)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
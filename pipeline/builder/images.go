@@ -0,0 +1,106 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+const (
+	// TriggerTagExpression is the SpEL expression of the tag pushed to the docker trigger
+	TriggerTagExpression = "${trigger['tag']}"
+)
+
+var (
+	// ErrNoDockerTrigger is returned when an image description uses a docker trigger the pipeline does not have
+	ErrNoDockerTrigger = errors.New("builder: image description is from a trigger but no docker trigger matches it")
+	// ErrAmbiguousDockerTrigger is returned when an image description without a repository could use more than one docker trigger
+	ErrAmbiguousDockerTrigger = errors.New("builder: image description is from a trigger but the pipeline has multiple docker triggers, set a repository")
+)
+
+// triggerImageDescriptions returns the image descriptions of a pipeline with
+// the ones that come from a docker trigger filled in from the trigger. It
+// returns nil when no image description uses a trigger.
+func triggerImageDescriptions(p *config.Pipeline) ([]config.ImageDescription, error) {
+	var fromTrigger bool
+	for _, desc := range p.ImageDescriptions {
+		fromTrigger = fromTrigger || desc.FromTrigger
+	}
+	if !fromTrigger {
+		return nil, nil
+	}
+
+	var triggers []*config.DockerTrigger
+	for _, t := range p.Triggers {
+		if t.Docker != nil {
+			triggers = append(triggers, t.Docker)
+		}
+	}
+
+	descriptions := make([]config.ImageDescription, len(p.ImageDescriptions))
+	for i, desc := range p.ImageDescriptions {
+		descriptions[i] = desc
+		if !desc.FromTrigger {
+			continue
+		}
+
+		t, err := dockerTriggerFor(desc, triggers)
+		if err != nil {
+			return nil, errors.Wrapf(err, "image description %s", desc.Name)
+		}
+
+		descriptions[i] = imageDescriptionFromTrigger(desc, t)
+	}
+
+	return descriptions, nil
+}
+
+func dockerTriggerFor(desc config.ImageDescription, triggers []*config.DockerTrigger) (*config.DockerTrigger, error) {
+	if desc.Repository == "" {
+		switch len(triggers) {
+		case 0:
+			return nil, ErrNoDockerTrigger
+		case 1:
+			return triggers[0], nil
+		}
+		return nil, ErrAmbiguousDockerTrigger
+	}
+
+	for _, t := range triggers {
+		if t.Repository == desc.Repository {
+			return t, nil
+		}
+	}
+
+	return nil, ErrNoDockerTrigger
+}
+
+// imageDescriptionFromTrigger fills in the fields of an image description that
+// are not set from the docker trigger, the tag is always the pushed tag
+func imageDescriptionFromTrigger(desc config.ImageDescription, t *config.DockerTrigger) config.ImageDescription {
+	if desc.Account == "" {
+		desc.Account = t.Account
+	}
+	if desc.Registry == "" {
+		desc.Registry = t.Registry
+	}
+	if desc.Organization == "" {
+		desc.Organization = t.Organization
+	}
+	if desc.Repository == "" {
+		desc.Repository = t.Repository
+	}
+
+	desc.Tag = TriggerTagExpression
+	if desc.ImageID == "" {
+		image := desc.Repository
+		if desc.Registry != "" {
+			image = desc.Registry + "/" + image
+		}
+		desc.ImageID = fmt.Sprintf("%s:%s", image, TriggerTagExpression)
+	}
+
+	return desc
+}
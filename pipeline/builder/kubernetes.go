@@ -1,11 +1,10 @@
 package builder
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
@@ -41,8 +40,8 @@ type ManifestGroup struct {
 // ManifestParser handles generating Spinnaker builder types from a kubernetes
 // manifest file (deployments)
 type ManifestParser struct {
-	config   *config.Pipeline
-	basePath string
+	config *config.Pipeline
+	files  files
 }
 
 // NewManfifestParser initializes and returns a manifest parser for a given pipeline config.
@@ -51,7 +50,7 @@ type ManifestParser struct {
 func NewManfifestParser(config *config.Pipeline, basePath ...string) *ManifestParser {
 	mp := &ManifestParser{config: config}
 	if len(basePath) > 0 {
-		mp.basePath = basePath[0]
+		mp.files.basePath = basePath[0]
 	}
 
 	return mp
@@ -59,16 +58,7 @@ func NewManfifestParser(config *config.Pipeline, basePath ...string) *ManifestPa
 
 // ManifestFromFile creates a dynamic kubernetes objects for a given pipeline config
 func (mp *ManifestParser) ManifestFromFile(path string) (runtime.Object, error) {
-	if !filepath.IsAbs(path) && mp.basePath != "" {
-		path = filepath.Join(mp.basePath, path)
-	}
-
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-
-	b, err := ioutil.ReadAll(f)
+	b, err := mp.files.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -84,18 +74,25 @@ func (mp *ManifestParser) ManifestFromFile(path string) (runtime.Object, error)
 
 // ManifestsFromFile creates an array of dynamic kubernetes objects for a given pipeline config
 func (mp *ManifestParser) ManifestsFromFile(path string) ([]runtime.Object, error) {
-	if !filepath.IsAbs(path) && mp.basePath != "" {
-		path = filepath.Join(mp.basePath, path)
-	}
-
-	f, err := os.Open(path)
+	b, err := mp.files.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
+	return mp.ManifestsFromReader(bytes.NewReader(b))
+}
+
+// ManifestsFromReader creates an array of dynamic kubernetes objects from the
+// YAML documents of a reader, e.g. manifests rendered in memory
+func (mp *ManifestParser) ManifestsFromReader(r io.Reader) ([]runtime.Object, error) {
+	return decodeManifests(r)
+}
+
+// decodeManifests decodes every YAML document of a reader into a dynamic kubernetes object
+func decodeManifests(in io.Reader) ([]runtime.Object, error) {
 	objs := make([]runtime.Object, 0)
 
-	r := yaml.NewDocumentDecoder(f)
+	r := yaml.NewDocumentDecoder(ioutil.NopCloser(in))
 	decode := scheme.Codecs.UniversalDeserializer().Decode
 
 	for {
@@ -203,16 +200,7 @@ func (mp *ManifestParser) InjectContainerImageDescription(container corev1.Conta
 func (mp *ManifestParser) ContainersFromScaffold(scaffold config.ContainerScaffold) (*ManifestGroup, error) {
 
 	path := scaffold.Manifest()
-	if !filepath.IsAbs(scaffold.Manifest()) && mp.basePath != "" {
-		path = filepath.Join(mp.basePath, scaffold.Manifest())
-	}
-
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-
-	b, err := ioutil.ReadAll(f)
+	b, err := mp.files.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -228,8 +216,8 @@ func (mp *ManifestParser) ContainersFromScaffold(scaffold config.ContainerScaffo
 
 	switch g.Kind {
 	case "Deployment":
-		resource = &appsv1.Deployment{}
-		if err := scheme.Scheme.Convert(obj, resource, nil); err != nil {
+		resource, err = toAppsV1Deployment(obj)
+		if err != nil {
 			return nil, err
 		}
 	case "Pod":
@@ -262,6 +250,22 @@ func (mp *ManifestParser) ContainersFromScaffold(scaffold config.ContainerScaffo
 	return &mg, nil
 }
 
+// toAppsV1Deployment converts a deployment of any api version to apps/v1, the
+// pod template is the same in every version
+func toAppsV1Deployment(obj runtime.Object) (*appsv1.Deployment, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &appsv1.Deployment{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, d); err != nil {
+		return nil, errors.Wrap(err, "could not convert the deployment to apps/v1")
+	}
+
+	return d, nil
+}
+
 // converts kubernetes volume sources into builder types
 func (mp *ManifestParser) volumeSources(vols []corev1.Volume) []*types.VolumeSource {
 	var vs []*types.VolumeSource
@@ -358,6 +362,7 @@ func (mp *ManifestParser) parseContainer(container corev1.Container, scaffold co
 		Repository:   imageDescription.Repository,
 		Registry:     imageDescription.Registry,
 		Organization: imageDescription.Organization,
+		FromTrigger:  imageDescription.FromTrigger,
 	}
 	args := []string{}
 	if container.Args != nil {
@@ -3,6 +3,7 @@ package builder_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -362,3 +363,12 @@ func TestEmpyYMLObject(t *testing.T) {
 
 	})
 }
+
+func TestManifestsFromReader(t *testing.T) {
+	parser := builder.NewManfifestParser(&config.Pipeline{})
+
+	objs, err := parser.ManifestsFromReader(strings.NewReader("---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n---\n"))
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	assert.Equal(t, "ConfigMap", objs[0].GetObjectKind().GroupVersionKind().Kind)
+}
@@ -0,0 +1,59 @@
+package builder
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/kustomize/api/krusty"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+var (
+	// ErrNoKustomization is returned when a kustomize dir has neither a dir nor an overlay for the environment of the stage
+	ErrNoKustomization = errors.New("builder: no kustomization for the environment")
+)
+
+// kustomizeManifests renders the kustomization of a kustomize dir for the
+// environment of the stage account
+func (b *Builder) kustomizeManifests(kd config.KustomizeDir, account string) ([]runtime.Object, error) {
+	env, err := b.stageEnvironment(account, kd.Environment)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, ok := kd.Overlays[env]
+	if !ok {
+		dir = kd.Dir
+	}
+	if dir == "" {
+		return nil, errors.Wrapf(ErrNoKustomization, "env %s", env)
+	}
+	fsys, dir, err := b.kustomizeFS(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := k.Run(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not render kustomize overlay %s", dir)
+	}
+
+	var objs []runtime.Object
+	for _, r := range resources.Resources() {
+		m, err := r.Map()
+		if err != nil {
+			return nil, errors.Wrapf(err, "kustomize overlay %s: could not convert resource %s", dir, r.CurId())
+		}
+
+		u := &unstructured.Unstructured{Object: m}
+		if u.GetKind() == "" || u.GetAPIVersion() == "" {
+			return nil, errors.Errorf("kustomize overlay %s: resource %s is missing type meta", dir, r.CurId())
+		}
+
+		objs = append(objs, u)
+	}
+
+	return objs, nil
+}
@@ -0,0 +1,79 @@
+package builder
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+var (
+	// ErrUnknownImageDescription is returned when a stage references an image description the pipeline does not define
+	ErrUnknownImageDescription = errors.New("builder: unknown image description")
+	// ErrNoImageContainer is returned when no container of a stage matches the container name of an image description
+	ErrNoImageContainer = errors.New("builder: no container matches the image description")
+	// ErrNoImage is returned when an image description has neither an image_id nor a repository
+	ErrNoImage = errors.New("builder: image description does not describe an image")
+)
+
+// injectImageDescriptions replaces the images of the containers referenced by
+// the image descriptions of an embedded manifest stage
+func (b *Builder) injectImageDescriptions(objs []runtime.Object, refs []config.ImageDescriptionRef) error {
+	for _, ref := range refs {
+		image, err := b.imageReference(ref.Name)
+		if err != nil {
+			return err
+		}
+
+		var injected bool
+		for _, obj := range objs {
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			for _, c := range b.workloads.AllContainers(u) {
+				if c["name"] == ref.ContainerName {
+					c["image"] = image
+					injected = true
+				}
+			}
+		}
+
+		if !injected {
+			return errors.Wrapf(ErrNoImageContainer, "image description %s, container %s", ref.Name, ref.ContainerName)
+		}
+	}
+
+	return nil
+}
+
+// imageReference returns the image of a pipeline image description, either
+// its image_id or the image built from the registry, repository and tag
+func (b *Builder) imageReference(name string) (string, error) {
+	for _, desc := range b.pipeline.ImageDescriptions {
+		if desc.Name != name {
+			continue
+		}
+
+		if desc.ImageID != "" {
+			return desc.ImageID, nil
+		}
+		if desc.Repository == "" {
+			return "", errors.Wrap(ErrNoImage, name)
+		}
+
+		image := desc.Repository
+		if desc.Registry != "" {
+			image = desc.Registry + "/" + image
+		}
+		if desc.Tag != "" {
+			image += ":" + desc.Tag
+		}
+
+		return image, nil
+	}
+
+	return "", errors.Wrap(ErrUnknownImageDescription, name)
+}
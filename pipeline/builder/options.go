@@ -1,5 +1,14 @@
 package builder
 
+import (
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/namely/k8s-pipeliner/pipeline/remote"
+)
+
 // OptFunc is used to assign configuration values to a pipeline builder
 type OptFunc func(b *Builder)
 
@@ -11,6 +20,15 @@ func WithLinear(l bool) OptFunc {
 	}
 }
 
+// WithHybrid makes the builder keep declared refIds, derive the missing ones
+// from the stage names and make stages without reliesOn depend on the previous
+// stage, explicit reliesOn are kept
+func WithHybrid(h bool) OptFunc {
+	return func(b *Builder) {
+		b.isHybrid = h
+	}
+}
+
 // WithBasePath assigns the base path for the builder to use when given
 // relatively pathed files for manifests
 func WithBasePath(basePath string) OptFunc {
@@ -32,3 +50,65 @@ func WithAccountOverride(accounts map[string]string) OptFunc {
 		b.overrideAccounts = accounts
 	}
 }
+
+// WithPipelineID sets the ID of the generated pipeline, taking precedence
+// over the id defined in the pipeline config
+func WithPipelineID(id string) OptFunc {
+	return func(b *Builder) {
+		b.pipelineID = id
+	}
+}
+
+// WithDeterministicID derives a stable pipeline ID from the application and
+// pipeline name when no ID is given explicitly
+func WithDeterministicID(d bool) OptFunc {
+	return func(b *Builder) {
+		b.deterministicID = d
+	}
+}
+
+// WithWorkloads registers additional kinds that embed a pod spec, usually
+// custom resources, so their containers can be overridden and validated
+func WithWorkloads(workloads ...config.Workload) OptFunc {
+	return func(b *Builder) {
+		for _, w := range workloads {
+			b.workloads.Register(w.Group, w.Kind, strings.Split(w.PodSpecPath, ".")...)
+		}
+	}
+}
+
+// WithEnvironmentMap maps the accounts of stages to the environments of their
+// configurator files and kustomize overlays. The environments of the pipeline
+// config are matched first, the built in mapping is only used without either.
+func WithEnvironmentMap(envs config.Environments) OptFunc {
+	return func(b *Builder) {
+		b.environmentMaps = append(b.environmentMaps, envs)
+	}
+}
+
+// WithFS makes the builder read the manifests, charts and other files of the
+// pipeline config from fsys instead of the disk, e.g. an embedded file system
+// or a git tree. Relative paths resolve against the directory of the pipeline
+// file, which is the slash separated path of the pipeline config in fsys.
+func WithFS(fsys fs.FS, pipelineFile string) OptFunc {
+	return func(b *Builder) {
+		b.fsys = fsys
+		b.basePath = path.Dir(pipelineFile)
+	}
+}
+
+// WithRootPath makes the builder fail for files of the pipeline config that
+// resolve outside of root, usually the root of the repository
+func WithRootPath(root string) OptFunc {
+	return func(b *Builder) {
+		b.rootPath = root
+	}
+}
+
+// WithRemote fetches the remote manifest references of the pipeline config,
+// ie: https:// urls, with the given fetcher. Without one remote references fail.
+func WithRemote(f *remote.Fetcher) OptFunc {
+	return func(b *Builder) {
+		b.remote = f
+	}
+}
@@ -0,0 +1,293 @@
+package builder
+
+import (
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+var (
+	// ErrNoOverrideContainer is returned when container overrides name a container that no manifest of the stage defines
+	ErrNoOverrideContainer = errors.New("builder: no container matches the container overrides")
+)
+
+// applyContainerOverrides applies the overrides to every container and init
+// container with the same name in the manifests of an embedded manifest stage
+func (b *Builder) applyContainerOverrides(objs []runtime.Object, overrides []*config.ContainerOverrides) error {
+	for _, o := range overrides {
+		var applied bool
+		for _, obj := range objs {
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			for _, c := range b.workloads.AllContainers(u) {
+				if c["name"] != o.Name {
+					continue
+				}
+
+				if err := overrideContainer(c, o); err != nil {
+					return errors.Wrapf(err, "container %s", o.Name)
+				}
+				applied = true
+			}
+		}
+
+		if !applied {
+			return errors.Wrap(ErrNoOverrideContainer, o.Name)
+		}
+	}
+
+	return nil
+}
+
+func overrideContainer(c map[string]interface{}, o *config.ContainerOverrides) error {
+	if o.Command != nil {
+		c["command"] = stringList(o.Command)
+	}
+	if o.Args != nil {
+		c["args"] = stringList(o.Args)
+	}
+	if o.Image != "" {
+		c["image"] = o.Image
+	}
+	if o.ImagePullPolicy != "" {
+		c["imagePullPolicy"] = o.ImagePullPolicy
+	}
+
+	if err := overrideResources(c, o); err != nil {
+		return err
+	}
+
+	for _, env := range o.Env {
+		if err := upsert(c, "env", "name", envVar(env)); err != nil {
+			return err
+		}
+	}
+	for _, name := range o.RemoveEnv {
+		remove(c, "env", "name", name)
+	}
+	for _, from := range o.EnvFrom {
+		if err := upsert(c, "envFrom", "", envFromSource(from)); err != nil {
+			return err
+		}
+	}
+	for _, mount := range o.VolumeMounts {
+		if err := upsert(c, "volumeMounts", "mountPath", &corev1.VolumeMount{
+			Name:      mount.Name,
+			MountPath: mount.MountPath,
+			SubPath:   mount.SubPath,
+			ReadOnly:  mount.ReadOnly,
+		}); err != nil {
+			return err
+		}
+	}
+
+	for field, probe := range map[string]*config.Probe{
+		"livenessProbe":  o.LivenessProbe,
+		"readinessProbe": o.ReadinessProbe,
+		"startupProbe":   o.StartupProbe,
+	} {
+		if probe == nil {
+			continue
+		}
+
+		p, err := runtime.DefaultUnstructuredConverter.ToUnstructured(k8sProbe(probe))
+		if err != nil {
+			return errors.Wrapf(err, "could not convert %s", field)
+		}
+		c[field] = p
+	}
+
+	return nil
+}
+
+// overrideResources replaces the requests and limits that are set in the
+// overrides. The other resources of the container are kept and the quantities
+// are written as strings so the manifest stays valid unstructured content.
+func overrideResources(c map[string]interface{}, o *config.ContainerOverrides) error {
+	if o.Resources == nil {
+		return nil
+	}
+
+	for _, r := range []struct {
+		field    string
+		override *config.Resource
+	}{
+		{"requests", o.Resources.Requests},
+		{"limits", o.Resources.Limits},
+	} {
+		if r.override == nil {
+			continue
+		}
+
+		existing, _, _ := unstructured.NestedFieldNoCopy(c, "resources", r.field)
+		list, _ := existing.(map[string]interface{})
+		if list == nil {
+			list = make(map[string]interface{})
+		}
+
+		if err := overrideResource(list, r.override); err != nil {
+			return errors.Wrapf(err, errOverrideResource, r.field, o.Name)
+		}
+		if err := setNestedFieldNoCopy(c, list, "resources", r.field); err != nil {
+			return errors.Wrapf(err, "failed to set resources %s for container: %s", r.field, o.Name)
+		}
+	}
+
+	return nil
+}
+
+// overrideResource sets the cpu and memory of the override in an unstructured
+// resource list
+func overrideResource(list map[string]interface{}, override *config.Resource) error {
+	for _, r := range []struct {
+		name  corev1.ResourceName
+		value string
+	}{
+		{corev1.ResourceCPU, override.CPU},
+		{corev1.ResourceMemory, override.Memory},
+	} {
+		if r.value == "" {
+			continue
+		}
+
+		qty, err := resource.ParseQuantity(r.value)
+		if err != nil {
+			return errors.Wrapf(err, "could not parse %s", r.name)
+		}
+		list[r.name.String()] = qty.String()
+	}
+
+	return nil
+}
+
+// upsert converts obj and replaces the item of the list field that has the
+// same value for key, or appends it. An empty key always appends.
+func upsert(c map[string]interface{}, field, key string, obj interface{}) error {
+	item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return errors.Wrapf(err, "could not convert %s", field)
+	}
+
+	list, _ := c[field].([]interface{})
+	for i, existing := range list {
+		m, ok := existing.(map[string]interface{})
+		if ok && key != "" && m[key] == item[key] {
+			list[i] = item
+			return nil
+		}
+	}
+
+	c[field] = append(list, item)
+	return nil
+}
+
+// remove drops the items of the list field that have the given value for key
+func remove(c map[string]interface{}, field, key, value string) {
+	list, _ := c[field].([]interface{})
+
+	kept := make([]interface{}, 0, len(list))
+	for _, existing := range list {
+		if m, ok := existing.(map[string]interface{}); ok && m[key] == value {
+			continue
+		}
+		kept = append(kept, existing)
+	}
+
+	c[field] = kept
+}
+
+func stringList(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+
+	return list
+}
+
+func envVar(env config.EnvVar) *corev1.EnvVar {
+	v := &corev1.EnvVar{Name: env.Name, Value: env.Value}
+	if from := env.ValueFrom; from != nil {
+		v.ValueFrom = &corev1.EnvVarSource{}
+		if ref := from.SecretKeyRef; ref != nil {
+			v.ValueFrom.SecretKeyRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name},
+				Key:                  ref.Key,
+				Optional:             optional(ref.Optional),
+			}
+		}
+		if ref := from.ConfigMapKeyRef; ref != nil {
+			v.ValueFrom.ConfigMapKeyRef = &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name},
+				Key:                  ref.Key,
+				Optional:             optional(ref.Optional),
+			}
+		}
+		if ref := from.FieldRef; ref != nil {
+			v.ValueFrom.FieldRef = &corev1.ObjectFieldSelector{FieldPath: ref.FieldPath}
+		}
+	}
+
+	return v
+}
+
+func envFromSource(from config.EnvFromSource) *corev1.EnvFromSource {
+	s := &corev1.EnvFromSource{Prefix: from.Prefix}
+	if ref := from.ConfigMapRef; ref != nil {
+		s.ConfigMapRef = &corev1.ConfigMapEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name},
+			Optional:             optional(ref.Optional),
+		}
+	}
+	if ref := from.SecretRef; ref != nil {
+		s.SecretRef = &corev1.SecretEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name},
+			Optional:             optional(ref.Optional),
+		}
+	}
+
+	return s
+}
+
+func k8sProbe(p *config.Probe) *corev1.Probe {
+	probe := &corev1.Probe{
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		SuccessThreshold:    p.SuccessThreshold,
+		FailureThreshold:    p.FailureThreshold,
+	}
+
+	if p.Exec != nil {
+		probe.Exec = &corev1.ExecAction{Command: p.Exec.Command}
+	}
+	if p.HTTPGet != nil {
+		probe.HTTPGet = &corev1.HTTPGetAction{
+			Path:   p.HTTPGet.Path,
+			Port:   intstr.Parse(p.HTTPGet.Port),
+			Scheme: corev1.URIScheme(p.HTTPGet.Scheme),
+		}
+	}
+	if p.TCPSocket != nil {
+		probe.TCPSocket = &corev1.TCPSocketAction{Port: intstr.Parse(p.TCPSocket.Port)}
+	}
+
+	return probe
+}
+
+// optional only sets the optional flag of a reference when it is true
+func optional(b bool) *bool {
+	if !b {
+		return nil
+	}
+
+	return &b
+}
@@ -0,0 +1,106 @@
+package builder
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+var (
+	// ErrLinearAndHybrid is returned when both the linear and the hybrid dependency modes are enabled
+	ErrLinearAndHybrid = errors.New("builder: linear and hybrid refs can't be used together")
+	// ErrDuplicateRefID is returned in hybrid mode when two stages declare the same refId
+	ErrDuplicateRefID = errors.New("builder: refId is declared by more than one stage")
+	// ErrUnknownRefID is returned in hybrid mode when a stage relies on a refId no stage declares
+	ErrUnknownRefID = errors.New("builder: reliesOn references an unknown refId")
+	// ErrAmbiguousRefID is returned in hybrid mode when the refId derived from a stage name is already taken
+	ErrAmbiguousRefID = errors.New("builder: the refId derived from the stage name is already taken, declare a refId on the stage")
+)
+
+// resolveHybridRefs assigns the refIds and dependencies of every stage in the
+// hybrid dependency mode:
+//
+//   - declared refIds, numeric or symbolic (ie: deploy-int), are kept as they are
+//   - missing refIds are derived from the stage name (ie: Deploy int becomes
+//     deploy-int), a derived refId that is already taken is an error
+//   - stages without reliesOn depend on the previous stage, an empty reliesOn
+//     list starts a stage in parallel to the start of the pipeline
+//
+// The refIds of stages don't depend on their position, so adding or removing
+// a stage leaves the refIds of the others unchanged. Stages whose names derive
+// the same refId have to declare one, numbering them in order would rewire the
+// reliesOn of the later ones when a stage with the same name is inserted.
+func resolveHybridRefs(stages []config.Stage) ([]config.Stage, error) {
+	resolved := make([]config.Stage, len(stages))
+	copy(resolved, stages)
+
+	taken := make(map[string]bool)
+	for _, s := range stages {
+		if s.RefID == "" {
+			continue
+		}
+		if taken[s.RefID] {
+			return nil, errors.Wrapf(ErrDuplicateRefID, "refId %s", s.RefID)
+		}
+		taken[s.RefID] = true
+	}
+
+	for i, s := range stages {
+		if s.RefID != "" {
+			continue
+		}
+
+		id := refSlug(s.Name)
+		if taken[id] {
+			return nil, errors.Wrapf(ErrAmbiguousRefID, "stage %d (%s) derives %s", i+1, s.Name, id)
+		}
+		taken[id] = true
+		resolved[i].RefID = id
+	}
+
+	for i, s := range stages {
+		if s.ReliesOn == nil {
+			resolved[i].ReliesOn = []string{}
+			if i > 0 {
+				resolved[i].ReliesOn = []string{resolved[i-1].RefID}
+			}
+			continue
+		}
+
+		resolved[i].ReliesOn = make([]string, len(s.ReliesOn))
+		for j, ref := range s.ReliesOn {
+			if !taken[ref] {
+				return nil, errors.Wrapf(ErrUnknownRefID, "stage %d (%s) relies on %s", i+1, s.Name, ref)
+			}
+			resolved[i].ReliesOn[j] = ref
+		}
+	}
+
+	return resolved, nil
+}
+
+// refSlug turns a stage name into a refId, ie: Deploy to int? becomes deploy-to-int
+func refSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	if b.Len() == 0 {
+		return "stage"
+	}
+
+	return b.String()
+}
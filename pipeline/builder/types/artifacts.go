@@ -0,0 +1,22 @@
+package types
+
+// ExpectedArtifact is an artifact a spinnaker pipeline expects to be provided
+// by a trigger or resolved from its default artifact
+type ExpectedArtifact struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName,omitempty"`
+
+	MatchArtifact      Artifact  `json:"matchArtifact"`
+	DefaultArtifact    *Artifact `json:"defaultArtifact,omitempty"`
+	UseDefaultArtifact bool      `json:"useDefaultArtifact"`
+	UsePriorArtifact   bool      `json:"usePriorArtifact"`
+}
+
+// Artifact is the JSON of a spinnaker artifact
+type Artifact struct {
+	ArtifactAccount string `json:"artifactAccount,omitempty"`
+	Type            string `json:"type"`
+	Name            string `json:"name,omitempty"`
+	Reference       string `json:"reference,omitempty"`
+	Version         string `json:"version,omitempty"`
+}
@@ -0,0 +1,28 @@
+package types
+
+// BakeManifestStage renders manifests inside spinnaker, the rendered manifest
+// is produced as the artifact of its expected artifacts
+type BakeManifestStage struct {
+	StageMetadata
+
+	TemplateRenderer  string             `json:"templateRenderer"`
+	OutputName        string             `json:"outputName"`
+	Namespace         string             `json:"namespace,omitempty"`
+	InputArtifacts    []InputArtifact    `json:"inputArtifacts,omitempty"`
+	InputArtifact     *InputArtifact     `json:"inputArtifact,omitempty"`
+	KustomizeFilePath string             `json:"kustomizeFilePath,omitempty"`
+	Overrides         map[string]string  `json:"overrides"`
+	ExpectedArtifacts []ExpectedArtifact `json:"expectedArtifacts"`
+}
+
+func (bs BakeManifestStage) spinnakerStage() {}
+
+var _ Stage = BakeManifestStage{}
+
+// InputArtifact is an artifact a stage consumes with the account to fetch it
+// with, either an expected artifact by its id or an inline artifact
+type InputArtifact struct {
+	Account  string    `json:"account"`
+	ID       string    `json:"id,omitempty"`
+	Artifact *Artifact `json:"artifact,omitempty"`
+}
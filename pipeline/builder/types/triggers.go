@@ -9,6 +9,9 @@ type Trigger interface {
 type TriggerObject struct {
 	Enabled bool   `json:"enabled"`
 	Type    string `json:"type"`
+
+	// ExpectedArtifactIDs binds the artifacts of the trigger to expected artifacts of the pipeline
+	ExpectedArtifactIDs []string `json:"expectedArtifactIds,omitempty"`
 }
 
 // StageMetadata is the common components of a stage in spinnaker such as name
@@ -48,3 +51,74 @@ type WebhookTrigger struct {
 var _ Trigger = (*WebhookTrigger)(nil)
 
 func (t *WebhookTrigger) spinnakerTrigger() {}
+
+// DockerTrigger constructs the JSON for a docker registry trigger in Spinnaker
+// pipelines
+type DockerTrigger struct {
+	TriggerObject
+
+	Account      string `json:"account"`
+	Organization string `json:"organization,omitempty"`
+	Registry     string `json:"registry,omitempty"`
+	Repository   string `json:"repository"`
+	Tag          string `json:"tag,omitempty"`
+}
+
+var _ Trigger = (*DockerTrigger)(nil)
+
+func (t *DockerTrigger) spinnakerTrigger() {}
+
+// GitTrigger constructs the JSON for a git push trigger in Spinnaker pipelines
+type GitTrigger struct {
+	TriggerObject
+
+	Source  string `json:"source"`
+	Project string `json:"project"`
+	Slug    string `json:"slug"`
+	Branch  string `json:"branch,omitempty"`
+	Secret  string `json:"secret,omitempty"`
+}
+
+var _ Trigger = (*GitTrigger)(nil)
+
+func (t *GitTrigger) spinnakerTrigger() {}
+
+// CronTrigger constructs the JSON for a scheduled trigger in Spinnaker pipelines
+type CronTrigger struct {
+	TriggerObject
+
+	CronExpression string `json:"cronExpression"`
+	CronTimeZone   string `json:"cronTimeZone,omitempty"`
+}
+
+var _ Trigger = (*CronTrigger)(nil)
+
+func (t *CronTrigger) spinnakerTrigger() {}
+
+// PipelineTrigger constructs the JSON for a trigger on the completion of
+// another Spinnaker pipeline
+type PipelineTrigger struct {
+	TriggerObject
+
+	Application string   `json:"application"`
+	Pipeline    string   `json:"pipeline"`
+	Status      []string `json:"status"`
+}
+
+var _ Trigger = (*PipelineTrigger)(nil)
+
+func (t *PipelineTrigger) spinnakerTrigger() {}
+
+// PubSubTrigger constructs the JSON for a pub/sub message trigger in Spinnaker pipelines
+type PubSubTrigger struct {
+	TriggerObject
+
+	PubSubSystem         string            `json:"pubsubSystem"`
+	SubscriptionName     string            `json:"subscriptionName"`
+	PayloadConstraints   map[string]string `json:"payloadConstraints,omitempty"`
+	AttributeConstraints map[string]string `json:"attributeConstraints,omitempty"`
+}
+
+var _ Trigger = (*PubSubTrigger)(nil)
+
+func (t *PubSubTrigger) spinnakerTrigger() {}
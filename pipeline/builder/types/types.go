@@ -29,6 +29,8 @@ type SpinnakerPipeline struct {
 	Stages        []Stage        `json:"stages"`
 	Notifications []Notification `json:"notifications"`
 
+	ExpectedArtifacts []ExpectedArtifact `json:"expectedArtifacts,omitempty"`
+
 	// Pipeline level config
 	LimitConcurrent      bool   `json:"limitConcurrent"`
 	KeepWaitingPipelines bool   `json:"keepWaitingPipelines"`
@@ -68,11 +70,13 @@ type ManifestStage struct {
 	// Location means kubernetes namespace
 	Location                string           `json:"location"`
 	ManifestArtifactAccount string           `json:"manifestArtifactAccount"`
+	ManifestArtifactID      string           `json:"manifestArtifactId,omitempty"`
 	ManifestName            string           `json:"manifestName"`
 	Manifests               []runtime.Object `json:"manifests"`
 	Moniker                 Moniker          `json:"moniker"`
 	Relationships           Relationships    `json:"relationships"`
 	Source                  string           `json:"source"`
+	RequiredArtifactIDs     []string         `json:"requiredArtifactIds,omitempty"`
 
 	CompleteOtherBranchesThenFail *bool `json:"completeOtherBranchesThenFail,omitempty"`
 	ContinuePipeline              *bool `json:"continuePipeline,omitempty"`
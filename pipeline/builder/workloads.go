@@ -0,0 +1,83 @@
+package builder
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Workloads maps the kinds that embed a pod spec to the path of the pod spec
+// in their manifests. Container overrides, image descriptions and the
+// manifest validation rules find the containers of a manifest through it.
+type Workloads map[schema.GroupKind][]string
+
+// DefaultWorkloads returns the built in kinds that embed a pod spec
+func DefaultWorkloads() Workloads {
+	template := []string{"spec", "template", "spec"}
+
+	w := Workloads{}
+	for _, group := range []string{"apps", "extensions"} {
+		w.Register(group, "Deployment", template...)
+		w.Register(group, "DaemonSet", template...)
+		w.Register(group, "ReplicaSet", template...)
+	}
+	w.Register("apps", "StatefulSet", template...)
+	w.Register("batch", "Job", template...)
+	w.Register("batch", "CronJob", "spec", "jobTemplate", "spec", "template", "spec")
+	w.Register("", "Pod", "spec")
+	w.Register("argoproj.io", "Rollout", template...)
+
+	return w
+}
+
+// Register adds a kind with the path to its pod spec, replacing the path of a
+// kind that is already registered
+func (w Workloads) Register(group, kind string, path ...string) {
+	w[schema.GroupKind{Group: group, Kind: kind}] = path
+}
+
+// PodSpec returns the pod spec of a manifest, the second value is false when
+// the kind is not registered or the manifest has no pod spec
+func (w Workloads) PodSpec(u *unstructured.Unstructured) (map[string]interface{}, bool) {
+	path, ok := w[u.GroupVersionKind().GroupKind()]
+	if !ok {
+		return nil, false
+	}
+
+	spec, ok, _ := unstructured.NestedFieldNoCopy(u.Object, path...)
+	if !ok {
+		return nil, false
+	}
+
+	m, ok := spec.(map[string]interface{})
+	return m, ok
+}
+
+// Containers returns the containers of the pod spec of a manifest
+func (w Workloads) Containers(u *unstructured.Unstructured) []map[string]interface{} {
+	return w.containers(u, "containers")
+}
+
+// AllContainers returns the init containers followed by the containers of
+// the pod spec of a manifest
+func (w Workloads) AllContainers(u *unstructured.Unstructured) []map[string]interface{} {
+	return w.containers(u, "initContainers", "containers")
+}
+
+func (w Workloads) containers(u *unstructured.Unstructured, fields ...string) []map[string]interface{} {
+	spec, ok := w.PodSpec(u)
+	if !ok {
+		return nil
+	}
+
+	var containers []map[string]interface{}
+	for _, field := range fields {
+		items, _ := spec[field].([]interface{})
+		for _, item := range items {
+			if c, ok := item.(map[string]interface{}); ok {
+				containers = append(containers, c)
+			}
+		}
+	}
+
+	return containers
+}
@@ -4,33 +4,76 @@ package config
 import (
 	"io"
 	"io/ioutil"
+	"reflect"
+	"strings"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
 // NewPipeline unmarshals a reader into a pipeline object
-func NewPipeline(r io.Reader) (*Pipeline, error) {
+func NewPipeline(r io.Reader, opts ...OptFunc) (*Pipeline, error) {
+	d := &decoder{}
+	for _, opt := range opts {
+		opt(d)
+	}
+
 	content, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
+	return d.decode(content)
+}
+
+type decoder struct {
+	strict   bool
+	filename string
+	vars     map[string]interface{}
+	files    FileReader
+}
+
+func (d *decoder) decode(content []byte) (*Pipeline, error) {
+	content, vars, err := d.render(d.filename, content, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	var p Pipeline
-	if err := yaml.Unmarshal(content, &p); err != nil {
+	if err := d.unmarshal(d.filename, content, &p); err != nil {
+		return nil, err
+	}
+
+	if err := d.include(&p, vars); err != nil {
 		return nil, err
 	}
 
 	return &p, nil
 }
 
+// unmarshal decodes the content of a pipeline file or an included file into out
+func (d *decoder) unmarshal(filename string, content []byte, out interface{}) error {
+	if !d.strict {
+		return fileError(filename, yaml.Unmarshal(content, out))
+	}
+
+	if err := unknownFields(filename, content, reflect.TypeOf(out).Elem()); err != nil {
+		return err
+	}
+
+	return fileError(filename, yaml.UnmarshalStrict(content, out))
+}
+
 // Pipeline is the high level struct that contains all of the configuration
 // of a pipeline
 type Pipeline struct {
-	Name              string             `yaml:"name"`
-	Application       string             `yaml:"application"`
+	// ID is the spinnaker pipeline ID, only needed when updating an existing pipeline
+	ID                string             `yaml:"id,omitempty"`
+	Name              string             `yaml:"name" jsonschema:"required"`
+	Application       string             `yaml:"application" jsonschema:"required"`
 	Triggers          []Trigger          `yaml:"triggers"`
-	Stages            []Stage            `yaml:"stages"`
+	Stages            []Stage            `yaml:"stages" jsonschema:"required"`
 	ImageDescriptions []ImageDescription `yaml:"imageDescriptions"`
+	ExpectedArtifacts []ExpectedArtifact `yaml:"expectedArtifacts,omitempty"`
 
 	DisableConcurrentExecutions bool   `yaml:"disableConcurrentExecutions"`
 	KeepQueuedPipelines         bool   `yaml:"keepQueuedPipelines"`
@@ -38,11 +81,22 @@ type Pipeline struct {
 
 	Notifications []Notification `yaml:"notifications"`
 	Parameters    []Parameter    `yaml:"parameters"`
+
+	// Environments map the accounts of the stages to the environments of their
+	// configurator files and kustomize overlays, before the project environments
+	Environments *Environments `yaml:"environments,omitempty"`
+
+	// Vars are the defaults of the {{ .Vars.<name> }} substitutions of the
+	// pipeline file and the files it includes
+	Vars map[string]interface{} `yaml:"vars,omitempty"`
+	// Include are files whose stages, notifications and image descriptions are
+	// added before the ones of the pipeline, they are read like its manifests
+	Include []string `yaml:"include,omitempty"`
 }
 
 // Parameter defines a single parameter in a pipeline config
 type Parameter struct {
-	Name        string   `yaml:"name"`
+	Name        string   `yaml:"name" jsonschema:"required"`
 	Description string   `yaml:"description"`
 	Default     string   `yaml:"default"`
 	Required    bool     `yaml:"required"`
@@ -51,41 +105,142 @@ type Parameter struct {
 
 // Option contains the option value of a single parameter in a pipeline config
 type Option struct {
-	Value string `yaml:"value"`
+	Value string `yaml:"value" jsonschema:"required"`
 }
 
 // ImageDescription contains the description of an image that can be referenced
 // from stages to inject in an image.
 type ImageDescription struct {
-	Name         string `yaml:"name"`
+	Name         string `yaml:"name" jsonschema:"required"`
 	Account      string `yaml:"account"`
 	ImageID      string `yaml:"image_id"`
 	Registry     string `yaml:"registry"`
 	Repository   string `yaml:"repository"`
 	Tag          string `yaml:"tag"`
 	Organization string `yaml:"organization"`
+
+	// FromTrigger uses the image pushed to the docker trigger with the same
+	// repository (or the only docker trigger) instead of a fixed image_id and tag
+	FromTrigger bool `yaml:"fromTrigger,omitempty"`
+}
+
+// ExpectedArtifact is an artifact the pipeline needs to run. Triggers bind the
+// artifacts they provide to it through the match artifact, the default
+// artifact is used when no trigger provides one.
+type ExpectedArtifact struct {
+	ID          string `yaml:"id" jsonschema:"required"`
+	DisplayName string `yaml:"displayName,omitempty"`
+
+	Match   Artifact  `yaml:"match" jsonschema:"required"`
+	Default *Artifact `yaml:"default,omitempty"`
+
+	// UsePriorArtifact falls back to the artifact of the previous execution
+	UsePriorArtifact bool `yaml:"usePriorArtifact,omitempty"`
+}
+
+// Artifact describes a spinnaker artifact such as a docker image or a file in
+// a git repository, the fields of a match artifact are regular expressions
+type Artifact struct {
+	// Type is one of docker/image, github/file, gitlab/file, s3/object, http/file, helm/chart or git/repo
+	Type      string `yaml:"type" jsonschema:"required"`
+	Name      string `yaml:"name,omitempty"`
+	Reference string `yaml:"reference,omitempty"`
+	Version   string `yaml:"version,omitempty"`
+	// Account is the spinnaker artifact account used to fetch the artifact
+	Account string `yaml:"account,omitempty"`
 }
 
 // Trigger contains the fields that are relevant for
 // spinnaker triggers such as jenkins or docker registry
 type Trigger struct {
-	Jenkins *JenkinsTrigger `yaml:"jenkins"`
-	Webhook *WebhookTrigger `yaml:"webhook"`
+	Jenkins  *JenkinsTrigger  `yaml:"jenkins"`
+	Webhook  *WebhookTrigger  `yaml:"webhook"`
+	Docker   *DockerTrigger   `yaml:"docker,omitempty"`
+	Git      *GitTrigger      `yaml:"git,omitempty"`
+	Cron     *CronTrigger     `yaml:"cron,omitempty"`
+	Pipeline *PipelineTrigger `yaml:"pipeline,omitempty"`
+	PubSub   *PubSubTrigger   `yaml:"pubsub,omitempty"`
 }
 
 // JenkinsTrigger has the fields for triggering a Jenkins job
 type JenkinsTrigger struct {
-	Job          string `yaml:"job"`
-	Master       string `yaml:"master"`
+	Job          string `yaml:"job" jsonschema:"required"`
+	Master       string `yaml:"master" jsonschema:"required"`
 	PropertyFile string `yaml:"propertyFile,omitempty"`
 	Enabled      *bool  `yaml:"enabled"`
+
+	ExpectedArtifactIDs []string `yaml:"expectedArtifactIds,omitempty"`
+}
+
+// DockerTrigger starts a pipeline when an image is pushed to a docker registry
+type DockerTrigger struct {
+	// Account is the docker registry account configured in spinnaker
+	Account      string `yaml:"account" jsonschema:"required"`
+	Registry     string `yaml:"registry,omitempty"`
+	Organization string `yaml:"organization,omitempty"`
+	// Repository includes the organization, ie: namely/web
+	Repository string `yaml:"repository" jsonschema:"required"`
+	// Tag is a regular expression the pushed tag has to match, every tag triggers when empty
+	Tag     string `yaml:"tag,omitempty"`
+	Enabled *bool  `yaml:"enabled,omitempty"`
+
+	ExpectedArtifactIDs []string `yaml:"expectedArtifactIds,omitempty"`
+}
+
+// GitTrigger starts a pipeline when commits are pushed to a git repository
+type GitTrigger struct {
+	// Source is the git host, one of github, gitlab, bitbucket or stash
+	Source  string `yaml:"source" jsonschema:"required"`
+	Project string `yaml:"project" jsonschema:"required"`
+	Slug    string `yaml:"slug" jsonschema:"required"`
+	// Branch is a regular expression the pushed branch has to match
+	Branch string `yaml:"branch,omitempty"`
+	// Secret is used to verify the signature of github webhooks
+	Secret string `yaml:"secret,omitempty"`
+
+	ExpectedArtifactIDs []string `yaml:"expectedArtifactIds,omitempty"`
+	Enabled             *bool    `yaml:"enabled,omitempty"`
+}
+
+// CronTrigger starts a pipeline on a schedule
+type CronTrigger struct {
+	// Expression is a quartz cron expression, ie: 0 0 10 ? * MON-FRI
+	Expression string `yaml:"expression" jsonschema:"required"`
+	TimeZone   string `yaml:"timezone,omitempty"`
+
+	ExpectedArtifactIDs []string `yaml:"expectedArtifactIds,omitempty"`
+	Enabled             *bool    `yaml:"enabled,omitempty"`
+}
+
+// PipelineTrigger starts a pipeline when another pipeline finishes
+type PipelineTrigger struct {
+	Application string `yaml:"application" jsonschema:"required"`
+	// Pipeline is the ID of the upstream pipeline
+	Pipeline string `yaml:"pipeline" jsonschema:"required"`
+	// Status lists the upstream results that trigger, any of successful, failed or canceled
+	Status []string `yaml:"status" jsonschema:"required"`
+
+	ExpectedArtifactIDs []string `yaml:"expectedArtifactIds,omitempty"`
+	Enabled             *bool    `yaml:"enabled,omitempty"`
+}
+
+// PubSubTrigger starts a pipeline when a message is published to a subscription
+type PubSubTrigger struct {
+	// System is the pub/sub provider, one of google or amazon
+	System       string `yaml:"system" jsonschema:"required"`
+	Subscription string `yaml:"subscription" jsonschema:"required"`
+
+	PayloadConstraints   map[string]string `yaml:"payloadConstraints,omitempty"`
+	AttributeConstraints map[string]string `yaml:"attributeConstraints,omitempty"`
+	ExpectedArtifactIDs  []string          `yaml:"expectedArtifactIds,omitempty"`
+	Enabled              *bool             `yaml:"enabled,omitempty"`
 }
 
 // JenkinsStage has fields for triggering a Jenkins job
 type JenkinsStage struct {
 	Type string `yaml:"type,omitempty"`
 
-	Job string `yaml:"job"`
+	Job string `yaml:"job" jsonschema:"required"`
 	// string:string map of parameters to pass into the build
 	Parameters []PassthroughParameter `yaml:"parameters,omitempty"`
 
@@ -100,8 +255,8 @@ type JenkinsStage struct {
 
 // PassthroughParameter represents a key value pair passed to a child process
 type PassthroughParameter struct {
-	Key   string `yaml:"key"`
-	Value string `yaml:"value"`
+	Key   string `yaml:"key" jsonschema:"required"`
+	Value string `yaml:"value" jsonschema:"required"`
 }
 
 // RunSpinnakerPipelineStage represents a stage where another pipeline is executed
@@ -110,8 +265,8 @@ type RunSpinnakerPipelineStage struct {
 
 	Job string `yaml:"job"`
 
-	Application string `yaml:"application"`
-	Pipeline    string `yaml:"pipeline"`
+	Application string `yaml:"application" jsonschema:"required"`
+	Pipeline    string `yaml:"pipeline" jsonschema:"required"`
 
 	// string:string map of parameters to pass into the build
 	PipelineParameters []PassthroughParameter `yaml:"parameters,omitempty"`
@@ -127,15 +282,17 @@ type RunSpinnakerPipelineStage struct {
 // WebhookTrigger defines how a webhook can trigger a pipeline execution
 type WebhookTrigger struct {
 	Enabled bool   `yaml:"enabled"`
-	Source  string `yaml:"source"`
+	Source  string `yaml:"source" jsonschema:"required"`
+
+	ExpectedArtifactIDs []string `yaml:"expectedArtifactIds,omitempty"`
 }
 
 // WebHookStage is a stage that triggers a webhook
 type WebHookStage struct {
-	Name          string              `yaml:"name"`
+	Name          string              `yaml:"name" jsonschema:"required"`
 	Description   string              `yaml:"description"`
-	Method        string              `yaml:"method"`
-	URL           string              `yaml:"url"`
+	Method        string              `yaml:"method" jsonschema:"required"`
+	URL           string              `yaml:"url" jsonschema:"required"`
 	CustomHeaders map[string][]string `yaml:"customHeaders"`
 	Payload       string              `yaml:"payload"`
 }
@@ -161,14 +318,35 @@ type Stage struct {
 	Jenkins                 *JenkinsStage              `yaml:"jenkins,omitempty"`
 	RunSpinnakerPipeline    *RunSpinnakerPipelineStage `yaml:"spinnaker,omitempty"`
 	EvaluateVariables       *EvaluateVariablesStage    `yaml:"variables,omitempty"`
+	BakeManifest            *BakeManifestStage         `yaml:"bakeManifest,omitempty"`
+}
+
+// Types returns the yaml keys of the stage types that are set on the stage,
+// a valid stage sets exactly one of them
+func (s Stage) Types() []string {
+	var set []string
+
+	v := reflect.ValueOf(s)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Type.Kind() != reflect.Ptr || f.Type.Elem().Kind() != reflect.Struct {
+			continue
+		}
+
+		if !v.Field(i).IsNil() {
+			set = append(set, strings.Split(f.Tag.Get("yaml"), ",")[0])
+		}
+	}
+
+	return set
 }
 
 // Notification config from pipeline configuration on a stage or pipeline
 type Notification struct {
-	Address string            `yaml:"address"`
+	Address string            `yaml:"address" jsonschema:"required"`
 	Level   string            `yaml:"level"`
-	Type    string            `yaml:"type"`
-	When    []string          `yaml:"when"`
+	Type    string            `yaml:"type" jsonschema:"required"`
+	When    []string          `yaml:"when" jsonschema:"required"`
 	Message map[string]string `yaml:"message"`
 }
 
@@ -181,7 +359,7 @@ type Container struct {
 
 // RunJobStage is the configuration for a one off job in a spinnaker pipeline
 type RunJobStage struct {
-	ManifestFile      string                `yaml:"manifestFile"`
+	ManifestFile      string                `yaml:"manifestFile" jsonschema:"required"`
 	ImageDescriptions []ImageDescriptionRef `yaml:"imageDescriptions"`
 
 	Container          *Container    `yaml:"container"`
@@ -192,21 +370,21 @@ type RunJobStage struct {
 
 // DeployStage is the configuration for deploying a cluster of servers (pods)
 type DeployStage struct {
-	Groups []Group `yaml:"groups"`
+	Groups []Group `yaml:"groups" jsonschema:"required"`
 }
 
 // ImageDescriptionRef represents a reference to a defined ImageDescription on
 // a given pipeline
 type ImageDescriptionRef struct {
-	Name          string `yaml:"name"`
-	ContainerName string `yaml:"containerName"`
+	Name          string `yaml:"name" jsonschema:"required"`
+	ContainerName string `yaml:"containerName" jsonschema:"required"`
 }
 
 // Group represents a group to be deployed (Think: Kubernetes Pods). Most of the configuration
 // of a group is filled out by the defined manifest file. This means things like commands, env vars,
 // etc, are all pulled into the group spec for you.
 type Group struct {
-	ManifestFile      string                `yaml:"manifestFile"`
+	ManifestFile      string                `yaml:"manifestFile" jsonschema:"required"`
 	ImageDescriptions []ImageDescriptionRef `yaml:"imageDescriptions"`
 
 	MaxRemainingASGS int      `yaml:"maxRemainingASGS"`
@@ -242,7 +420,31 @@ type ManualJudgementStage struct {
 // ManifestFile represents a single manifest file
 type ManifestFile struct {
 	Environment string `yaml:"env,omitempty"`
-	File        string `yaml:"file"`
+	File        string `yaml:"file" jsonschema:"required"`
+}
+
+// KustomizeDir is a kustomization that is rendered for the environment of the
+// stage account, like configurator files the environment can be overridden
+type KustomizeDir struct {
+	Environment string `yaml:"env,omitempty"`
+	// Dir is rendered when no overlay is set for the environment
+	Dir string `yaml:"dir,omitempty"`
+	// Overlays are the kustomizations of each environment
+	Overlays map[string]string `yaml:"overlays,omitempty"`
+}
+
+// HelmChart is a local helm chart that is templated into the manifests of a
+// stage, values files are applied in order and the inline values last
+type HelmChart struct {
+	Chart       string                 `yaml:"chart" jsonschema:"required"`
+	ReleaseName string                 `yaml:"releaseName" jsonschema:"required"`
+	Namespace   string                 `yaml:"namespace,omitempty"`
+	ValuesFiles []string               `yaml:"valuesFiles,omitempty"`
+	Values      map[string]interface{} `yaml:"values,omitempty"`
+
+	// Bake makes spinnaker render the chart in a bakeManifest stage with the
+	// HELM2 or HELM3 template renderer instead
+	Bake string `yaml:"bake,omitempty"`
 }
 
 // DeployEmbeddedManifests is a Kubernetes V2 provider stage configuration
@@ -251,7 +453,11 @@ type DeployEmbeddedManifests struct {
 	DefaultMoniker     *Moniker              `yaml:"defaultMoniker,omitempty"`
 	ConfiguratorFiles  []ManifestFile        `yaml:"configuratorFiles,omitempty"`
 	Files              []ManifestFile        `yaml:"files"`
+	KustomizeDirs      []KustomizeDir        `yaml:"kustomizeDirs,omitempty"`
+	HelmCharts         []HelmChart           `yaml:"helmCharts,omitempty"`
 	ContainerOverrides []*ContainerOverrides `yaml:"containerOverrides,omitempty"`
+	// ImageDescriptions replace the images of the referenced containers in the manifests
+	ImageDescriptions []ImageDescriptionRef `yaml:"imageDescriptions,omitempty"`
 
 	CompleteOtherBranchesThenFail *bool `yaml:"completeOtherBranchesThenFail,omitempty"`
 	ContinuePipeline              *bool `yaml:"continuePipeline,omitempty"`
@@ -259,6 +465,22 @@ type DeployEmbeddedManifests struct {
 	MarkUnstableAsSuccessful      *bool `yaml:"markUnstableAsSuccessful,omitempty"`
 	WaitForCompletion             *bool `yaml:"waitForCompletion,omitempty"`
 	StageTimeoutMS                int64 `yaml:"stageTimeoutMs,omitempty"`
+
+	// ManifestArtifactID deploys the manifests of an expected artifact instead of files
+	ManifestArtifactID string `yaml:"manifestArtifactId,omitempty"`
+	// RequiredArtifactIDs are expected artifacts that spinnaker substitutes into the manifests, ie: image tags
+	RequiredArtifactIDs []string `yaml:"requiredArtifactIds,omitempty"`
+}
+
+// BakesHelmChart reports whether spinnaker renders the helm chart of the stage
+func (dm *DeployEmbeddedManifests) BakesHelmChart() bool {
+	for _, hc := range dm.HelmCharts {
+		if hc.Bake != "" {
+			return true
+		}
+	}
+
+	return false
 }
 
 // DeleteEmbeddedManifest represents a single resource to be deleted
@@ -266,7 +488,7 @@ type DeployEmbeddedManifests struct {
 // Internally, the builder uses a Delete Manifest stage that matches on
 // name and type. The namespace is populated from the manifest metadata.
 type DeleteEmbeddedManifest struct {
-	File string `yaml:"file"`
+	File string `yaml:"file" jsonschema:"required"`
 
 	CompleteOtherBranchesThenFail *bool `yaml:"completeOtherBranchesThenFail,omitempty"`
 	ContinuePipeline              *bool `yaml:"continuePipeline,omitempty"`
@@ -286,10 +508,10 @@ type Moniker struct {
 // ScaleManifest is a Kubernetes V2 provider stage configuration
 // for scaling a Kubernetes object
 type ScaleManifest struct {
-	Kind      string `yaml:"kind"`
-	Name      string `yaml:"name"`
-	Namespace string `yaml:"namespace"`
-	Replicas  int    `yaml:"replicas"`
+	Kind      string `yaml:"kind" jsonschema:"required"`
+	Name      string `yaml:"name" jsonschema:"required"`
+	Namespace string `yaml:"namespace" jsonschema:"required"`
+	Replicas  int    `yaml:"replicas" jsonschema:"required"`
 
 	CompleteOtherBranchesThenFail *bool `yaml:"completeOtherBranchesThenFail,omitempty"`
 	ContinuePipeline              *bool `yaml:"continuePipeline,omitempty"`
@@ -311,12 +533,107 @@ type Resource struct {
 }
 
 // ContainerOverrides are used to override a containers values for simple
-// values like the command and arguments
+// values like the command and arguments. Deploy groups only apply the command
+// and arguments, embedded manifests apply every field.
 type ContainerOverrides struct {
-	Name      string     `yaml:"name"`
+	Name      string     `yaml:"name" jsonschema:"required"`
 	Args      []string   `yaml:"args,omitempty"`
 	Command   []string   `yaml:"command,omitempty"`
 	Resources *Resources `yaml:"resources,omitempty"`
+
+	Image           string `yaml:"image,omitempty"`
+	ImagePullPolicy string `yaml:"imagePullPolicy,omitempty"`
+
+	// Env adds variables or replaces the ones with the same name, RemoveEnv
+	// removes variables by name
+	Env       []EnvVar `yaml:"env,omitempty"`
+	RemoveEnv []string `yaml:"removeEnv,omitempty"`
+	// EnvFrom sources are appended to the ones of the container
+	EnvFrom []EnvFromSource `yaml:"envFrom,omitempty"`
+
+	LivenessProbe  *Probe `yaml:"livenessProbe,omitempty"`
+	ReadinessProbe *Probe `yaml:"readinessProbe,omitempty"`
+	StartupProbe   *Probe `yaml:"startupProbe,omitempty"`
+
+	// VolumeMounts are added or replace the mount with the same mountPath
+	VolumeMounts []VolumeMount `yaml:"volumeMounts,omitempty"`
+}
+
+// EnvVar is an environment variable set to a value or read from a source
+type EnvVar struct {
+	Name      string        `yaml:"name" jsonschema:"required"`
+	Value     string        `yaml:"value,omitempty"`
+	ValueFrom *EnvVarSource `yaml:"valueFrom,omitempty"`
+}
+
+// EnvVarSource reads an environment variable from a secret, config map or pod field
+type EnvVarSource struct {
+	SecretKeyRef    *KeySelector   `yaml:"secretKeyRef,omitempty"`
+	ConfigMapKeyRef *KeySelector   `yaml:"configMapKeyRef,omitempty"`
+	FieldRef        *FieldSelector `yaml:"fieldRef,omitempty"`
+}
+
+// KeySelector selects a key of a secret or config map
+type KeySelector struct {
+	Name     string `yaml:"name" jsonschema:"required"`
+	Key      string `yaml:"key" jsonschema:"required"`
+	Optional bool   `yaml:"optional,omitempty"`
+}
+
+// FieldSelector selects a field of the pod, ie: metadata.name
+type FieldSelector struct {
+	FieldPath string `yaml:"fieldPath" jsonschema:"required"`
+}
+
+// EnvFromSource imports every key of a secret or config map as environment variables
+type EnvFromSource struct {
+	Prefix       string      `yaml:"prefix,omitempty"`
+	ConfigMapRef *EnvFromRef `yaml:"configMapRef,omitempty"`
+	SecretRef    *EnvFromRef `yaml:"secretRef,omitempty"`
+}
+
+// EnvFromRef references a secret or config map by name
+type EnvFromRef struct {
+	Name     string `yaml:"name" jsonschema:"required"`
+	Optional bool   `yaml:"optional,omitempty"`
+}
+
+// Probe is a kubernetes container probe with one of exec, httpGet or tcpSocket
+type Probe struct {
+	Exec      *ExecProbe      `yaml:"exec,omitempty"`
+	HTTPGet   *HTTPGetProbe   `yaml:"httpGet,omitempty"`
+	TCPSocket *TCPSocketProbe `yaml:"tcpSocket,omitempty"`
+
+	InitialDelaySeconds int32 `yaml:"initialDelaySeconds,omitempty"`
+	TimeoutSeconds      int32 `yaml:"timeoutSeconds,omitempty"`
+	PeriodSeconds       int32 `yaml:"periodSeconds,omitempty"`
+	SuccessThreshold    int32 `yaml:"successThreshold,omitempty"`
+	FailureThreshold    int32 `yaml:"failureThreshold,omitempty"`
+}
+
+// ExecProbe runs a command in the container
+type ExecProbe struct {
+	Command []string `yaml:"command" jsonschema:"required"`
+}
+
+// HTTPGetProbe requests a path of the container, the port is a number or the name of a port
+type HTTPGetProbe struct {
+	Path   string `yaml:"path,omitempty"`
+	Port   string `yaml:"port" jsonschema:"required"`
+	Scheme string `yaml:"scheme,omitempty"`
+}
+
+// TCPSocketProbe opens a connection to a port of the container
+type TCPSocketProbe struct {
+	Port string `yaml:"port" jsonschema:"required"`
+}
+
+// VolumeMount mounts a volume of the pod into the container
+type VolumeMount struct {
+	Name      string `yaml:"name" jsonschema:"required"`
+	MountPath string `yaml:"mountPath" jsonschema:"required"`
+	SubPath   string `yaml:"subPath,omitempty"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
 }
 
 // PodOverrides are used to override certain attributes about a pod spec
@@ -372,3 +689,26 @@ func findImageDescription(containerName string, refs []ImageDescriptionRef) *Ima
 type EvaluateVariablesStage struct {
 	Variables []PassthroughParameter `yaml:"variables,omitempty"`
 }
+
+// BakeManifestStage renders manifests inside spinnaker from input artifacts,
+// the rendered manifest is deployed by later stages with the outputName as
+// their manifestArtifactId
+type BakeManifestStage struct {
+	// TemplateRenderer is one of HELM2, HELM3, KUSTOMIZE or KUSTOMIZE4
+	TemplateRenderer string          `yaml:"templateRenderer" jsonschema:"required"`
+	InputArtifacts   []InputArtifact `yaml:"inputArtifacts" jsonschema:"required"`
+	// Overrides are passed to helm like --set
+	Overrides map[string]string `yaml:"overrides,omitempty"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	// OutputName names the release and the produced artifact
+	OutputName string `yaml:"outputName" jsonschema:"required"`
+	// KustomizeFilePath is the kustomization.yaml in the input artifact of a kustomize render
+	KustomizeFilePath string `yaml:"kustomizeFilePath,omitempty"`
+}
+
+// InputArtifact references an expected artifact of the pipeline, the account
+// of the expected artifact is used unless one is given
+type InputArtifact struct {
+	ID      string `yaml:"id" jsonschema:"required"`
+	Account string `yaml:"account,omitempty"`
+}
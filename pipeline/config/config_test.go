@@ -4,8 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	multierror "github.com/hashicorp/go-multierror"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -20,6 +23,7 @@ func TestNewConfig(t *testing.T) {
 	cfg, err := config.NewPipeline(file)
 	require.Nil(t, err, "error generating new config from file reader")
 
+	assert.Equal(t, "6c1f7a36-0d4f-4b6e-9d52-5a1c3e2f8b10", cfg.ID)
 	assert.Equal(t, "Nginx Deployment", cfg.Name)
 	require.Len(t, cfg.Triggers, 1)
 	require.Equal(t, "nginx/job/master", cfg.Triggers[0].Jenkins.Job)
@@ -63,3 +67,62 @@ func TestNewConfig(t *testing.T) {
 	expectedHeaders := map[string][]string{"Content-Type": {"application/json"}}
 	assert.True(t, reflect.DeepEqual(expectedHeaders, webHookStage.WebHook.CustomHeaders))
 }
+
+func TestNewConfigStrict(t *testing.T) {
+	t.Run("Valid pipelines decode the same as the default mode", func(t *testing.T) {
+		wd, _ := os.Getwd()
+		file, err := os.Open(filepath.Join(wd, "testdata", "pipeline.full.yml"))
+		require.NoError(t, err)
+
+		cfg, err := config.NewPipeline(file, config.WithStrict(true))
+		require.NoError(t, err)
+		assert.Len(t, cfg.Stages, 4)
+	})
+
+	t.Run("Unknown fields are reported with their position", func(t *testing.T) {
+		content := `name: nginx
+application: nginx
+stages:
+  - name: Continue?
+    manualJudgment:
+      failPipeline: true
+  - name: Wait
+    manualJudgement:
+      timeout: 2
+`
+		_, err := config.NewPipeline(strings.NewReader(content), config.WithStrict(true), config.WithFilename("pipeline.yml"))
+		require.Error(t, err)
+
+		merr, ok := err.(*multierror.Error)
+		require.True(t, ok, "expected a multierror, got %T", err)
+		require.Len(t, merr.Errors, 2)
+
+		assert.Equal(t, &config.UnknownFieldError{
+			File:   "pipeline.yml",
+			Line:   5,
+			Column: 5,
+			Field:  "manualJudgment",
+			Path:   "stages[0]",
+		}, merr.Errors[0])
+		assert.Equal(t, `pipeline.yml:9:7: config: unknown field "timeout" in stages[1].manualJudgement`, merr.Errors[1].Error())
+	})
+
+	t.Run("Unknown fields are ignored by default", func(t *testing.T) {
+		cfg, err := config.NewPipeline(strings.NewReader("name: nginx\ncolour: blue\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "nginx", cfg.Name)
+	})
+
+	t.Run("Duplicate keys are rejected", func(t *testing.T) {
+		_, err := config.NewPipeline(strings.NewReader("name: nginx\nname: apache\n"), config.WithStrict(true))
+		assert.Error(t, err)
+	})
+}
+
+func TestStageTypes(t *testing.T) {
+	assert.Empty(t, config.Stage{Name: "empty"}.Types())
+	assert.Equal(t, []string{"manualJudgement", "spinnaker"}, config.Stage{
+		ManualJudgement:      &config.ManualJudgementStage{},
+		RunSpinnakerPipeline: &config.RunSpinnakerPipelineStage{},
+	}.Types())
+}
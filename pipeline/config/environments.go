@@ -0,0 +1,80 @@
+package config
+
+import (
+	"path"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FallbackDefault makes accounts that match no environment use the default environment
+	FallbackDefault = "default"
+	// FallbackError makes accounts that match no environment fail the build
+	FallbackError = "error"
+)
+
+var (
+	// ErrInvalidEnvironment is returned when an environment mapping does not have an env and exactly one of account or regex
+	ErrInvalidEnvironment = errors.New("config: environments need an env and either an account or a regex")
+	// ErrUnknownFallback is returned when the environments fallback is not default or error
+	ErrUnknownFallback = errors.New("config: environments fallback must be default or error")
+)
+
+// Environments maps the spinnaker accounts of stages to the environments of
+// their configurator files and kustomize overlays
+type Environments struct {
+	// Accounts are matched in order, the first match wins
+	Accounts []AccountEnvironment `yaml:"accounts,omitempty"`
+
+	// Fallback is default or error, it decides what happens to accounts that
+	// match none of the accounts
+	Fallback string `yaml:"fallback,omitempty"`
+}
+
+// AccountEnvironment maps the accounts matching a glob or a regex to an environment
+type AccountEnvironment struct {
+	// Account is the account name or a glob, e.g. staging-*
+	Account string `yaml:"account,omitempty"`
+	// Regex must match the whole account name
+	Regex       string `yaml:"regex,omitempty"`
+	Environment string `yaml:"env" jsonschema:"required"`
+}
+
+// Matches reports whether the account is matched by the glob or the regex
+func (ae AccountEnvironment) Matches(account string) (bool, error) {
+	if ae.Regex != "" {
+		re, err := regexp.Compile("^(?:" + ae.Regex + ")$")
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid account regex %s", ae.Regex)
+		}
+
+		return re.MatchString(account), nil
+	}
+
+	ok, err := path.Match(ae.Account, account)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid account glob %s", ae.Account)
+	}
+
+	return ok, nil
+}
+
+// Validate checks the patterns and the fallback of the environments
+func (e *Environments) Validate() error {
+	for i, ae := range e.Accounts {
+		if ae.Environment == "" || (ae.Account == "") == (ae.Regex == "") {
+			return errors.Wrapf(ErrInvalidEnvironment, "environment %d", i)
+		}
+		if _, err := ae.Matches(""); err != nil {
+			return errors.Wrapf(err, "environment %d", i)
+		}
+	}
+
+	switch e.Fallback {
+	case "", FallbackDefault, FallbackError:
+		return nil
+	default:
+		return errors.Wrap(ErrUnknownFallback, e.Fallback)
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+// OptFunc is used to configure how a pipeline config is decoded
+type OptFunc func(d *decoder)
+
+// WithStrict rejects pipeline configs that contain keys which are not part of
+// the config definitions, or keys that are defined more than once
+func WithStrict(s bool) OptFunc {
+	return func(d *decoder) {
+		d.strict = s
+	}
+}
+
+// WithFilename sets the file name used in the position of decoding errors
+func WithFilename(name string) OptFunc {
+	return func(d *decoder) {
+		d.filename = name
+	}
+}
+
+// WithVars overrides the vars of the pipeline file and the files it includes
+func WithVars(vars map[string]string) OptFunc {
+	return func(d *decoder) {
+		if d.vars == nil {
+			d.vars = make(map[string]interface{})
+		}
+		for k, v := range vars {
+			d.vars[k] = v
+		}
+	}
+}
+
+// WithFiles reads the files the pipeline file includes through r instead of
+// from disk relative to the pipeline file
+func WithFiles(r FileReader) OptFunc {
+	return func(d *decoder) {
+		d.files = r
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ProjectFile is the name of the project configuration file, it is looked up
+// in the directory of the pipeline file and its parents
+const ProjectFile = ".pipeliner.yml"
+
+// ErrInvalidWorkload is returned when a workload of the project config has no kind or pod spec path
+var ErrInvalidWorkload = errors.New("config: workloads need a kind and a podSpecPath")
+
+// Project contains the repository wide settings of k8s-pipeliner that are
+// shared by every pipeline file in it
+type Project struct {
+	Validation Validation `yaml:"validation,omitempty"`
+	Workloads  []Workload `yaml:"workloads,omitempty"`
+
+	// Environments are used by every pipeline that does not map its account itself
+	Environments *Environments `yaml:"environments,omitempty"`
+}
+
+// Workload registers a kind, usually a custom resource, that embeds a pod spec
+type Workload struct {
+	Group string `yaml:"group"`
+	Kind  string `yaml:"kind"`
+
+	// PodSpecPath is the dot separated path of the pod spec in the manifest,
+	// e.g. spec.template.spec
+	PodSpecPath string `yaml:"podSpecPath"`
+}
+
+// Validation configures the rules run by the validate command
+type Validation struct {
+	// Rules is keyed by the rule name
+	Rules map[string]RuleConfig `yaml:"rules,omitempty"`
+}
+
+// RuleConfig enables, disables or changes the severity of a single validation rule
+type RuleConfig struct {
+	Enabled  *bool  `yaml:"enabled,omitempty"`
+	Severity string `yaml:"severity,omitempty"`
+}
+
+// NewProject unmarshals a reader into a project object, unknown keys are rejected
+func NewProject(r io.Reader) (*Project, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Project
+	if err := yaml.UnmarshalStrict(content, &p); err != nil {
+		return nil, err
+	}
+
+	for i, w := range p.Workloads {
+		if w.Kind == "" || w.PodSpecPath == "" {
+			return nil, errors.Wrapf(ErrInvalidWorkload, "workload %d", i)
+		}
+	}
+
+	if p.Environments != nil {
+		if err := p.Environments.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+// LoadProject looks for a project file in dir and every parent directory of it
+// and decodes the first one found. An empty project is returned when there is none.
+func LoadProject(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := os.Open(filepath.Join(dir, ProjectFile))
+		if err == nil {
+			defer f.Close()
+
+			p, err := NewProject(f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not decode %s", f.Name())
+			}
+			return p, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return &Project{}, nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	multierror "github.com/hashicorp/go-multierror"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// UnknownFieldError is returned in strict mode for every key of a pipeline
+// config that does not match a config field
+type UnknownFieldError struct {
+	File   string
+	Line   int
+	Column int
+	Field  string
+	// Path is the location of the mapping that contains the field, ie: stages[2].manualJudgement
+	Path string
+}
+
+func (e *UnknownFieldError) Error() string {
+	pos := fmt.Sprintf("%d:%d", e.Line, e.Column)
+	if e.File != "" {
+		pos = e.File + ":" + pos
+	}
+
+	if e.Path == "" {
+		return fmt.Sprintf("%s: config: unknown field %q", pos, e.Field)
+	}
+
+	return fmt.Sprintf("%s: config: unknown field %q in %s", pos, e.Field, e.Path)
+}
+
+// unknownFields walks a YAML document and returns an error for every mapping
+// key that has no matching yaml tag on the go type it is decoded into
+func unknownFields(filename string, content []byte, t reflect.Type) error {
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(content, &doc); err != nil {
+		// syntax errors are reported by the decoder itself
+		return nil
+	}
+
+	var errs *multierror.Error
+	var walk func(n *yaml3.Node, t reflect.Type, path string)
+	walk = func(n *yaml3.Node, t reflect.Type, path string) {
+		for n.Kind == yaml3.AliasNode {
+			n = n.Alias
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		switch {
+		case n.Kind == yaml3.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, t, path)
+			}
+		case t.Kind() == reflect.Struct && n.Kind == yaml3.MappingNode:
+			fields := yamlFields(t)
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, value := n.Content[i], n.Content[i+1]
+				if key.Value == "<<" {
+					walk(value, t, path)
+					continue
+				}
+
+				f, ok := fields[key.Value]
+				if !ok {
+					errs = multierror.Append(errs, &UnknownFieldError{
+						File:   filename,
+						Line:   key.Line,
+						Column: key.Column,
+						Field:  key.Value,
+						Path:   path,
+					})
+					continue
+				}
+
+				walk(value, f, join(path, key.Value))
+			}
+		case t.Kind() == reflect.Slice && n.Kind == yaml3.SequenceNode:
+			for i, c := range n.Content {
+				walk(c, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+			}
+		case t.Kind() == reflect.Map && n.Kind == yaml3.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				walk(n.Content[i+1], t.Elem(), join(path, n.Content[i].Value))
+			}
+		}
+	}
+	walk(&doc, t, "")
+
+	if errs == nil {
+		return nil
+	}
+
+	errs.ErrorFormat = func(es []error) string {
+		lines := make([]string, len(es))
+		for i, e := range es {
+			lines[i] = e.Error()
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	return errs
+}
+
+// yamlFields returns the go types of a struct's fields keyed by their yaml name
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		key := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+
+		fields[key] = f.Type
+	}
+
+	return fields
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
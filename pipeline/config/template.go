@@ -0,0 +1,276 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/namely/k8s-pipeliner/pipeline/remote"
+)
+
+var (
+	// ErrIncludeCycle is returned when a pipeline file includes itself through its includes
+	ErrIncludeCycle = errors.New("config: pipeline includes are cyclic")
+	// ErrRemoteInclude is returned for remote includes when no file reader is set with WithFiles
+	ErrRemoteInclude = errors.New("config: remote files can only be included through a file reader set with WithFiles")
+	// ErrRelativeRemoteInclude is returned for relative includes of remote files
+	ErrRelativeRemoteInclude = errors.New("config: remote files can't include relative paths")
+	// ErrFragmentField is returned for top level keys of included files other than vars, include, stages, notifications and imageDescriptions
+	ErrFragmentField = errors.New("config: included files can only contain vars, include, stages, notifications and imageDescriptions")
+)
+
+// Fragment is the content of a file included by a pipeline, its entries are
+// added before the ones of the including file
+type Fragment struct {
+	Vars    map[string]interface{} `yaml:"vars,omitempty"`
+	Include []string               `yaml:"include,omitempty"`
+
+	Stages            []Stage            `yaml:"stages,omitempty"`
+	Notifications     []Notification     `yaml:"notifications,omitempty"`
+	ImageDescriptions []ImageDescription `yaml:"imageDescriptions,omitempty"`
+}
+
+// FileReader reads the files a pipeline file includes, ie: the files of a
+// builder, so they are resolved like the other files of the pipeline
+type FileReader interface {
+	// Path returns where a file is read from, it names the file in errors
+	Path(file string) (string, error)
+	ReadFile(file string) ([]byte, error)
+}
+
+// diskFiles reads includes from disk, relative to the directory of the
+// pipeline file
+type diskFiles struct {
+	dir string
+}
+
+func (f diskFiles) Path(file string) (string, error) {
+	if remote.IsRemote(file) || filepath.IsAbs(file) {
+		return file, nil
+	}
+
+	return filepath.Join(f.dir, file), nil
+}
+
+func (f diskFiles) ReadFile(file string) ([]byte, error) {
+	if remote.IsRemote(file) {
+		return nil, errors.Wrap(ErrRemoteInclude, file)
+	}
+
+	return ioutil.ReadFile(filepath.Join(f.dir, file))
+}
+
+// templateData is what the templates of pipeline files are executed with
+type templateData struct {
+	Vars map[string]interface{}
+}
+
+// templateUse matches the templates and the includes that make a pipeline file
+// a template, pipeline files without them are decoded as they are
+var templateUse = regexp.MustCompile(`{{[^}]*\.Vars|(?m)^include:`)
+
+// render executes a file as a template with its vars, the vars of the file
+// that includes it and the vars of the decoder, in increasing precedence.
+// Pipeline files that don't use vars or includes and have none in scope are
+// returned as is, included files are always rendered.
+func (d *decoder) render(filename string, content []byte, inherited map[string]interface{}) ([]byte, map[string]interface{}, error) {
+	defaults, err := fileVars(filename, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vars := make(map[string]interface{})
+	for _, m := range []map[string]interface{}{defaults, inherited, d.vars} {
+		for k, v := range m {
+			vars[k] = v
+		}
+	}
+	if inherited == nil && len(vars) == 0 && !templateUse.Match(content) {
+		return content, vars, nil
+	}
+
+	name := filename
+	if name == "" {
+		name = "pipeline"
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, templateData{Vars: vars}); err != nil {
+		return nil, nil, err
+	}
+
+	return buf.Bytes(), vars, nil
+}
+
+// fileVars reads the top level vars mapping of a file before it is rendered,
+// the other lines are blanked so errors keep the line numbers of the file
+func fileVars(filename string, content []byte) (map[string]interface{}, error) {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	inVars := false
+	for i, line := range lines {
+		continuation := len(bytes.TrimSpace(line)) == 0 || line[0] == ' ' || line[0] == '\t' || line[0] == '#'
+		if !continuation {
+			inVars = bytes.HasPrefix(line, []byte("vars:"))
+		}
+		if !inVars {
+			lines[i] = []byte("\n")
+		}
+	}
+
+	var v struct {
+		Vars map[string]interface{} `yaml:"vars"`
+	}
+	if err := yaml.Unmarshal(bytes.Join(lines, nil), &v); err != nil {
+		return nil, fileError(filename, err)
+	}
+
+	return v.Vars, nil
+}
+
+// include adds the entries of the files a pipeline includes
+func (d *decoder) include(p *Pipeline, vars map[string]interface{}) error {
+	stack := []string{d.filename}
+
+	for i := len(p.Include) - 1; i >= 0; i-- {
+		f, err := d.fragment(p.Include[i], vars, stack)
+		if err != nil {
+			return err
+		}
+
+		p.Stages = append(f.Stages, p.Stages...)
+		p.Notifications = append(f.Notifications, p.Notifications...)
+		p.ImageDescriptions = append(f.ImageDescriptions, p.ImageDescriptions...)
+	}
+
+	return nil
+}
+
+// fragment decodes an included file with the entries of its own includes
+// added, stack holds the files that are being included to detect cycles
+func (d *decoder) fragment(file string, inherited map[string]interface{}, stack []string) (*Fragment, error) {
+	files := d.fileReader()
+	filename, err := files.Path(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range stack {
+		if sameFile(f, filename) {
+			return nil, errors.Wrap(ErrIncludeCycle, strings.Join(append(stack, filename), " -> "))
+		}
+	}
+	stack = append(stack, filename)
+
+	content, err := files.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read the included file %s", file)
+	}
+
+	content, vars, err := d.render(filename, content, inherited)
+	if err != nil {
+		return nil, err
+	}
+
+	var f Fragment
+	if err := d.unmarshal(filename, content, &f); err != nil {
+		return nil, err
+	}
+	if !d.strict {
+		if err := fragmentFields(filename, content); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := len(f.Include) - 1; i >= 0; i-- {
+		nested, err := nestedInclude(file, f.Include[i])
+		if err != nil {
+			return nil, err
+		}
+
+		inc, err := d.fragment(nested, vars, stack)
+		if err != nil {
+			return nil, err
+		}
+
+		f.Stages = append(inc.Stages, f.Stages...)
+		f.Notifications = append(inc.Notifications, f.Notifications...)
+		f.ImageDescriptions = append(inc.ImageDescriptions, f.ImageDescriptions...)
+	}
+
+	return &f, nil
+}
+
+// fileReader returns the reader of the included files, files are read from
+// disk relative to the pipeline file without one
+func (d *decoder) fileReader() FileReader {
+	if d.files != nil {
+		return d.files
+	}
+
+	return diskFiles{dir: filepath.Dir(d.filename)}
+}
+
+// nestedInclude returns the path of a file included by an included file,
+// relative paths are relative to the directory of the including file
+func nestedInclude(parent, file string) (string, error) {
+	if remote.IsRemote(file) || path.IsAbs(file) || filepath.IsAbs(file) {
+		return file, nil
+	}
+	if remote.IsRemote(parent) {
+		return "", errors.Wrapf(ErrRelativeRemoteInclude, "%s includes %s", parent, file)
+	}
+
+	return path.Join(path.Dir(parent), file), nil
+}
+
+// fragmentFields rejects top level keys of included files that are not part
+// of a fragment, nested keys are only checked in strict mode
+func fragmentFields(filename string, content []byte) error {
+	var keys yaml.MapSlice
+	if err := yaml.Unmarshal(content, &keys); err != nil {
+		return fileError(filename, err)
+	}
+
+	fields := yamlFields(reflect.TypeOf(Fragment{}))
+	for _, item := range keys {
+		if _, ok := fields[fmt.Sprint(item.Key)]; !ok {
+			return errors.Wrapf(ErrFragmentField, "%s: %v", filename, item.Key)
+		}
+	}
+
+	return nil
+}
+
+// sameFile reports whether two pipeline file names point to the same file
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+
+	return absA == absB
+}
+
+// fileError prefixes decoding errors with the file they come from
+func fileError(filename string, err error) error {
+	if filename == "" {
+		return err
+	}
+
+	return errors.Wrap(err, filename)
+}
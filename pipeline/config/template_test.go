@@ -0,0 +1,95 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+// templatePipeline decodes a pipeline of the templates testdata
+func templatePipeline(t *testing.T, name string, opts ...config.OptFunc) (*config.Pipeline, error) {
+	filename := filepath.Join("testdata", "templates", name)
+	file, err := os.Open(filename)
+	require.NoError(t, err)
+	defer file.Close()
+
+	return config.NewPipeline(file, append([]config.OptFunc{config.WithFilename(filename)}, opts...)...)
+}
+
+func TestPipelineTemplates(t *testing.T) {
+	t.Run("Vars are substituted in the pipeline and its includes", func(t *testing.T) {
+		p, err := templatePipeline(t, "pipeline.yml", config.WithStrict(true))
+		require.NoError(t, err)
+
+		assert.Equal(t, "nginx Deployment", p.Name)
+		assert.Equal(t, "nginx", p.Application)
+
+		require.Len(t, p.Stages, 3)
+		assert.Equal(t, "Deploy nginx", p.Stages[0].Name)
+		assert.Equal(t, "int-k8s", p.Stages[0].Account)
+		assert.Equal(t, "manifests/nginx.yml", p.Stages[0].DeployEmbeddedManifests.Files[0].File)
+		assert.Equal(t, 2, p.Stages[1].ManualJudgement.Timeout)
+		assert.Equal(t, "Continue?", p.Stages[2].Name)
+
+		require.Len(t, p.ImageDescriptions, 1)
+		assert.Equal(t, "namely/nginx", p.ImageDescriptions[0].Repository)
+
+		require.Len(t, p.Notifications, 2)
+		assert.Equal(t, "#deploys", p.Notifications[0].Address)
+		assert.Equal(t, "#nginx", p.Notifications[1].Address)
+	})
+
+	t.Run("Vars are overridden per invocation", func(t *testing.T) {
+		p, err := templatePipeline(t, "pipeline.yml", config.WithVars(map[string]string{"service": "apache", "timeout": "5"}))
+		require.NoError(t, err)
+
+		assert.Equal(t, "apache", p.Application)
+		assert.Equal(t, "Deploy apache", p.Stages[0].Name)
+		assert.Equal(t, 5, p.Stages[1].ManualJudgement.Timeout)
+	})
+
+	t.Run("Vars that are not set fail the pipeline", func(t *testing.T) {
+		_, err := config.NewPipeline(strings.NewReader("name: nginx\nstages:\n  - name: \"Deploy {{ .Vars.tag }}\"\n"), config.WithFilename("pipeline.yml"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "pipeline.yml:3:")
+		assert.Contains(t, err.Error(), `"tag"`)
+	})
+
+	t.Run("Pipelines without vars or includes are not rendered", func(t *testing.T) {
+		p, err := config.NewPipeline(strings.NewReader("name: \"{{ build.number }}\"\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "{{ build.number }}", p.Name)
+	})
+
+	t.Run("Cyclic includes are rejected", func(t *testing.T) {
+		_, err := templatePipeline(t, "cycle.yml")
+		require.Error(t, err)
+
+		assert.Equal(t, config.ErrIncludeCycle, errors.Cause(err))
+		assert.Contains(t, err.Error(), filepath.Join("testdata", "templates", "fragments", "cycle.yml"))
+	})
+
+	t.Run("Missing vars are reported with their file and line", func(t *testing.T) {
+		_, err := templatePipeline(t, "missing-var.yml")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), filepath.Join("testdata", "templates", "missing-var.yml")+":5:")
+		assert.Contains(t, err.Error(), `"image"`)
+	})
+
+	t.Run("Included files can only contain fragments", func(t *testing.T) {
+		content := "name: nginx\ninclude:\n  - fragments/invalid.yml\n"
+		_, err := config.NewPipeline(strings.NewReader(content), config.WithFilename(filepath.Join("testdata", "templates", "invalid.yml")))
+		assert.Equal(t, config.ErrFragmentField, errors.Cause(err))
+
+		_, err = config.NewPipeline(strings.NewReader(content), config.WithStrict(true), config.WithFilename(filepath.Join("testdata", "templates", "invalid.yml")))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), filepath.Join("testdata", "templates", "fragments", "invalid.yml")+":1:1")
+	})
+}
@@ -0,0 +1,348 @@
+// Package diff implements a semantic comparison between a generated
+// spinnaker pipeline and a pipeline that is already deployed
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChangeType describes how a value differs between two pipelines
+type ChangeType string
+
+const (
+	// Added is used for values that only exist in the generated pipeline
+	Added ChangeType = "added"
+	// Removed is used for values that only exist in the reference pipeline
+	Removed ChangeType = "removed"
+	// Modified is used for values that exist in both pipelines but differ
+	Modified ChangeType = "modified"
+)
+
+// ServerManagedFields are top level pipeline fields that Spinnaker maintains
+// itself and are never part of a generated pipeline
+var ServerManagedFields = []string{"updateTs", "lastModifiedBy", "index", "createTs"}
+
+// Change is a single difference at a given path
+type Change struct {
+	Path string
+	Type ChangeType
+	From interface{}
+	To   interface{}
+}
+
+// StageDiff contains all of the changes of a single stage identified by its refId
+type StageDiff struct {
+	RefID   string
+	Name    string
+	Type    ChangeType
+	Changes []Change
+}
+
+// Report is the result of comparing two pipelines
+type Report struct {
+	Pipeline []Change
+	Stages   []StageDiff
+}
+
+// Empty returns true when both pipelines are equivalent
+func (r *Report) Empty() bool {
+	return len(r.Pipeline) == 0 && len(r.Stages) == 0
+}
+
+// Write prints a human readable version of the report
+func (r *Report) Write(w io.Writer) error {
+	if r.Empty() {
+		_, err := fmt.Fprintln(w, "no changes")
+		return err
+	}
+
+	var b strings.Builder
+	if len(r.Pipeline) > 0 {
+		b.WriteString("pipeline: modified\n")
+		writeChanges(&b, r.Pipeline)
+	}
+
+	for _, s := range r.Stages {
+		fmt.Fprintf(&b, "stage %s (%s): %s\n", s.RefID, s.Name, s.Type)
+		writeChanges(&b, s.Changes)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeChanges(b *strings.Builder, changes []Change) {
+	for _, c := range changes {
+		switch c.Type {
+		case Added:
+			fmt.Fprintf(b, "  + %s: %s\n", c.Path, format(c.To))
+		case Removed:
+			fmt.Fprintf(b, "  - %s: %s\n", c.Path, format(c.From))
+		case Modified:
+			fmt.Fprintf(b, "  ~ %s: %s => %s\n", c.Path, format(c.From), format(c.To))
+		}
+	}
+}
+
+func format(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return string(out)
+}
+
+// Normalize converts any JSON serializable value (such as a
+// types.SpinnakerPipeline) into the generic form used for comparisons
+func Normalize(v interface{}) (map[string]interface{}, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "diff: could not marshal pipeline")
+	}
+
+	return Parse(content)
+}
+
+// Parse decodes pipeline JSON into the generic form used for comparisons
+func Parse(content []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, errors.Wrap(err, "diff: could not decode pipeline JSON")
+	}
+
+	return m, nil
+}
+
+// Compare returns the changes required to turn the reference pipeline into the
+// generated pipeline. Stages are matched by their refId and embedded manifests
+// by their kind, namespace and name.
+func Compare(generated, reference map[string]interface{}) *Report {
+	r := &Report{}
+
+	ignored := map[string]bool{"stages": true}
+	for _, f := range ServerManagedFields {
+		ignored[f] = true
+	}
+
+	for _, key := range unionKeys(generated, reference) {
+		if ignored[key] {
+			continue
+		}
+		r.Pipeline = append(r.Pipeline, compareValues(key, reference[key], generated[key], hasKey(reference, key), hasKey(generated, key))...)
+	}
+
+	genStages := stagesByRefID(generated)
+	refStages := stagesByRefID(reference)
+
+	for _, refID := range unionKeys(toInterfaceMap(genStages), toInterfaceMap(refStages)) {
+		gen, inGen := genStages[refID]
+		ref, inRef := refStages[refID]
+
+		switch {
+		case inGen && !inRef:
+			r.Stages = append(r.Stages, StageDiff{RefID: refID, Name: stageName(gen), Type: Added})
+		case !inGen && inRef:
+			r.Stages = append(r.Stages, StageDiff{RefID: refID, Name: stageName(ref), Type: Removed})
+		default:
+			changes := compareStage(gen, ref)
+			if len(changes) > 0 {
+				r.Stages = append(r.Stages, StageDiff{RefID: refID, Name: stageName(gen), Type: Modified, Changes: changes})
+			}
+		}
+	}
+
+	return r
+}
+
+func compareStage(gen, ref map[string]interface{}) []Change {
+	var changes []Change
+
+	for _, key := range unionKeys(gen, ref) {
+		if key == "manifests" {
+			changes = append(changes, compareManifests(gen[key], ref[key])...)
+			continue
+		}
+
+		changes = append(changes, compareValues(key, ref[key], gen[key], hasKey(ref, key), hasKey(gen, key))...)
+	}
+
+	return changes
+}
+
+// compareManifests diffs embedded manifests field by field, matching them on
+// their identity instead of their position in the stage
+func compareManifests(gen, ref interface{}) []Change {
+	genManifests := manifestsByIdentity(gen)
+	refManifests := manifestsByIdentity(ref)
+
+	var changes []Change
+	for _, id := range unionKeys(genManifests, refManifests) {
+		p := fmt.Sprintf("manifests[%s]", id)
+		changes = append(changes, compareValues(p, refManifests[id], genManifests[id], hasKey(refManifests, id), hasKey(genManifests, id))...)
+	}
+
+	return changes
+}
+
+func compareValues(p string, from, to interface{}, hasFrom, hasTo bool) []Change {
+	switch {
+	case hasTo && !hasFrom:
+		return []Change{{Path: p, Type: Added, To: to}}
+	case hasFrom && !hasTo:
+		return []Change{{Path: p, Type: Removed, From: from}}
+	}
+
+	fromMap, fromIsMap := from.(map[string]interface{})
+	toMap, toIsMap := to.(map[string]interface{})
+	if fromIsMap && toIsMap {
+		var changes []Change
+		for _, key := range unionKeys(toMap, fromMap) {
+			changes = append(changes, compareValues(p+"."+key, fromMap[key], toMap[key], hasKey(fromMap, key), hasKey(toMap, key))...)
+		}
+		return changes
+	}
+
+	fromSlice, fromIsSlice := from.([]interface{})
+	toSlice, toIsSlice := to.([]interface{})
+	if fromIsSlice && toIsSlice {
+		fromNamed, fromOK := byName(fromSlice)
+		toNamed, toOK := byName(toSlice)
+		if fromOK && toOK {
+			return compareValues(p, fromNamed, toNamed, true, true)
+		}
+
+		var changes []Change
+		for i := 0; i < len(fromSlice) || i < len(toSlice); i++ {
+			var f, t interface{}
+			if i < len(fromSlice) {
+				f = fromSlice[i]
+			}
+			if i < len(toSlice) {
+				t = toSlice[i]
+			}
+			changes = append(changes, compareValues(fmt.Sprintf("%s[%d]", p, i), f, t, i < len(fromSlice), i < len(toSlice))...)
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(from, to) {
+		return nil
+	}
+
+	return []Change{{Path: p, Type: Modified, From: from, To: to}}
+}
+
+// byName keys a list of objects by their name field, which is how kubernetes
+// identifies containers, ports, env vars, volumes, etc. The second return value
+// is false if the list cannot be keyed that way.
+func byName(list []interface{}) (map[string]interface{}, bool) {
+	if len(list) == 0 {
+		return nil, false
+	}
+
+	named := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok {
+			return nil, false
+		}
+		if _, dup := named[name]; dup {
+			return nil, false
+		}
+		named[name] = m
+	}
+
+	return named, true
+}
+
+func stagesByRefID(p map[string]interface{}) map[string]map[string]interface{} {
+	stages := make(map[string]map[string]interface{})
+
+	list, _ := p["stages"].([]interface{})
+	for i, item := range list {
+		s, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		refID := fmt.Sprintf("%v", s["refId"])
+		if s["refId"] == nil || refID == "" {
+			refID = fmt.Sprintf("#%d", i)
+		}
+		stages[refID] = s
+	}
+
+	return stages
+}
+
+func manifestsByIdentity(v interface{}) map[string]interface{} {
+	manifests := make(map[string]interface{})
+
+	list, _ := v.([]interface{})
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			manifests[fmt.Sprintf("#%d", i)] = item
+			continue
+		}
+
+		meta, _ := m["metadata"].(map[string]interface{})
+		ns, _ := meta["namespace"].(string)
+		name, _ := meta["name"].(string)
+		kind, _ := m["kind"].(string)
+		if ns == "" {
+			ns = "default"
+		}
+
+		manifests[fmt.Sprintf("%s %s/%s", kind, ns, name)] = m
+	}
+
+	return manifests
+}
+
+func stageName(s map[string]interface{}) string {
+	name, _ := s["name"].(string)
+	return name
+}
+
+func hasKey(m map[string]interface{}, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func toInterfaceMap(m map[string]map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+
+	return out
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range []map[string]interface{}{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
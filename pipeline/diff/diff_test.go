@@ -0,0 +1,129 @@
+package diff_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/namely/k8s-pipeliner/pipeline/diff"
+)
+
+func loadReference(t *testing.T) map[string]interface{} {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "deployed.json"))
+	require.NoError(t, err)
+
+	ref, err := diff.Parse(content)
+	require.NoError(t, err)
+
+	return ref
+}
+
+func TestCompare(t *testing.T) {
+	t.Run("Identical pipelines have no changes", func(t *testing.T) {
+		report := diff.Compare(loadReference(t), loadReference(t))
+		assert.True(t, report.Empty())
+	})
+
+	t.Run("Server managed fields are ignored", func(t *testing.T) {
+		gen := loadReference(t)
+		delete(gen, "index")
+		delete(gen, "lastModifiedBy")
+		gen["updateTs"] = "1590000000000"
+
+		report := diff.Compare(gen, loadReference(t))
+		assert.True(t, report.Empty())
+	})
+
+	t.Run("Pipeline level fields are compared", func(t *testing.T) {
+		gen := loadReference(t)
+		gen["description"] = "deploys nginx everywhere"
+
+		report := diff.Compare(gen, loadReference(t))
+		require.Len(t, report.Pipeline, 1)
+		assert.Equal(t, diff.Change{
+			Path: "description",
+			Type: diff.Modified,
+			From: "deploys nginx",
+			To:   "deploys nginx everywhere",
+		}, report.Pipeline[0])
+		assert.Empty(t, report.Stages)
+	})
+
+	t.Run("Stages are matched by refId", func(t *testing.T) {
+		gen := loadReference(t)
+		stages := gen["stages"].([]interface{})
+		// reorder the stages and replace the webhook with a new stage
+		gen["stages"] = []interface{}{
+			stages[1],
+			stages[0],
+			map[string]interface{}{"refId": "4", "name": "New webhook", "type": "webhook"},
+		}
+
+		report := diff.Compare(gen, loadReference(t))
+		require.Len(t, report.Stages, 2)
+		assert.Equal(t, diff.StageDiff{RefID: "3", Name: "Old webhook", Type: diff.Removed}, report.Stages[0])
+		assert.Equal(t, diff.StageDiff{RefID: "4", Name: "New webhook", Type: diff.Added}, report.Stages[1])
+	})
+
+	t.Run("Manifests are diffed field by field", func(t *testing.T) {
+		gen := loadReference(t)
+		stage := gen["stages"].([]interface{})[0].(map[string]interface{})
+		manifests := stage["manifests"].([]interface{})
+
+		deploy := manifests[1].(map[string]interface{})
+		spec := deploy["spec"].(map[string]interface{})
+		spec["replicas"] = float64(3)
+		containers := spec["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+		// swap container order and change the image of one of them
+		containers[0], containers[1] = containers[1], containers[0]
+		containers[1].(map[string]interface{})["image"] = "nginx:1.19"
+
+		// manifest order does not matter
+		stage["manifests"] = []interface{}{manifests[1], manifests[0]}
+
+		report := diff.Compare(gen, loadReference(t))
+		require.Len(t, report.Stages, 1)
+		assert.Equal(t, "1", report.Stages[0].RefID)
+		assert.Equal(t, diff.Modified, report.Stages[0].Type)
+		assert.Equal(t, []diff.Change{
+			{
+				Path: "manifests[Deployment web/nginx].spec.replicas",
+				Type: diff.Modified,
+				From: float64(2),
+				To:   float64(3),
+			},
+			{
+				Path: "manifests[Deployment web/nginx].spec.template.spec.containers.nginx.image",
+				Type: diff.Modified,
+				From: "nginx:1.17",
+				To:   "nginx:1.19",
+			},
+		}, report.Stages[0].Changes)
+	})
+}
+
+func TestReportWrite(t *testing.T) {
+	gen := loadReference(t)
+	gen["limitConcurrent"] = false
+	stages := gen["stages"].([]interface{})
+	stages[1].(map[string]interface{})["instructions"] = "Ship it?"
+	gen["stages"] = stages[:2]
+
+	var buf bytes.Buffer
+	require.NoError(t, diff.Compare(gen, loadReference(t)).Write(&buf))
+
+	assert.Equal(t, `pipeline: modified
+  ~ limitConcurrent: true => false
+stage 2 (Continue?): modified
+  ~ instructions: "Continue?" => "Ship it?"
+stage 3 (Old webhook): removed
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, diff.Compare(loadReference(t), loadReference(t)).Write(&buf))
+	assert.Equal(t, "no changes\n", buf.String())
+}
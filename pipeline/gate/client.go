@@ -0,0 +1,224 @@
+// Package gate implements a small client for the Spinnaker Gate API that is
+// used to read and save pipeline configurations
+package gate
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout is how long a request to Gate can take, so publishing
+// doesn't hang when Gate doesn't answer
+const DefaultTimeout = 30 * time.Second
+
+var (
+	// ErrPipelineNotFound is returned when an application does not have a pipeline
+	// with the requested name
+	ErrPipelineNotFound = errors.New("gate: pipeline not found")
+	// ErrMissingApplication is returned when a pipeline is saved without an application
+	ErrMissingApplication = errors.New("gate: pipeline does not have an application defined")
+	// ErrPipelineIDConflict is returned when a pipeline has an ID that does not
+	// match the pipeline saved in Spinnaker with the same name
+	ErrPipelineIDConflict = errors.New("gate: pipeline id conflicts with the saved pipeline")
+	// ErrMissingName is returned when a pipeline is saved without a name
+	ErrMissingName = errors.New("gate: pipeline does not have a name defined")
+	// ErrCertificateTransport is returned when client certificates are set on an
+	// HTTP client whose transport is not an *http.Transport
+	ErrCertificateTransport = errors.New("gate: client certificates need an HTTP client with an *http.Transport")
+)
+
+// Client talks to a Spinnaker Gate API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+
+	certificates []tls.Certificate
+	adoptSavedID bool
+}
+
+// NewClient initializes a Gate client for the given API address.
+// ErrCertificateTransport is returned when the client certificates can't be
+// added to the transport of the HTTP client.
+func NewClient(baseURL string, opts ...OptFunc) (*Client, error) {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if len(c.certificates) > 0 {
+		hc, err := withCertificates(c.httpClient, c.certificates)
+		if err != nil {
+			return nil, err
+		}
+		c.httpClient = hc
+	}
+
+	return c, nil
+}
+
+// withCertificates returns a copy of an HTTP client that presents the given
+// client certificates, the client passed in is not modified
+func withCertificates(hc *http.Client, certs []tls.Certificate) (*http.Client, error) {
+	var transport *http.Transport
+	switch t := hc.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, errors.Wrapf(ErrCertificateTransport, "%T", t)
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.Certificates = append(transport.TLSClientConfig.Certificates, certs...)
+
+	client := *hc
+	client.Transport = transport
+	return &client, nil
+}
+
+// PipelineConfig fetches the saved pipeline configuration for an application
+// by its name. ErrPipelineNotFound is returned if the application does not
+// have a pipeline with that name.
+func (c *Client) PipelineConfig(application, name string) (map[string]interface{}, error) {
+	var configs []map[string]interface{}
+	endpoint := fmt.Sprintf("/applications/%s/pipelineConfigs", url.PathEscape(application))
+	if err := c.do(http.MethodGet, endpoint, nil, &configs); err != nil {
+		return nil, err
+	}
+
+	for _, cfg := range configs {
+		if cfg["name"] == name {
+			return cfg, nil
+		}
+	}
+
+	return nil, ErrPipelineNotFound
+}
+
+// ResolvePipelineID looks up the pipeline already saved in Spinnaker with the
+// same application and name and copies its ID onto the given pipeline, so that
+// saving it updates the existing pipeline instead of creating a duplicate.
+// A pipeline that does not exist yet is left untouched. If the given pipeline
+// already has an ID that differs from the saved one, ErrPipelineIDConflict is
+// returned, unless the client adopts the saved ID.
+func (c *Client) ResolvePipelineID(sp *types.SpinnakerPipeline) error {
+	if err := validatePipeline(sp); err != nil {
+		return err
+	}
+
+	existing, err := c.PipelineConfig(sp.Application, sp.Name)
+	if err == ErrPipelineNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	id, ok := existing["id"].(string)
+	if !ok {
+		return nil
+	}
+
+	if sp.ID != "" && sp.ID != id && !c.adoptSavedID {
+		return errors.Wrapf(ErrPipelineIDConflict, "pipeline %q is saved with id %s, not %s", sp.Name, id, sp.ID)
+	}
+	sp.ID = id
+
+	return nil
+}
+
+// SavePipeline creates or updates (when the ID is set) a pipeline in Spinnaker
+func (c *Client) SavePipeline(sp *types.SpinnakerPipeline) error {
+	if err := validatePipeline(sp); err != nil {
+		return err
+	}
+
+	return c.do(http.MethodPost, "/pipelines", sp, nil)
+}
+
+// UpsertPipeline resolves the ID of an existing pipeline and saves the given
+// pipeline over it
+func (c *Client) UpsertPipeline(sp *types.SpinnakerPipeline) error {
+	if err := c.ResolvePipelineID(sp); err != nil {
+		return err
+	}
+
+	return c.SavePipeline(sp)
+}
+
+func (c *Client) do(method, endpoint string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf := &bytes.Buffer{}
+		if err := json.NewEncoder(buf).Encode(in); err != nil {
+			return errors.Wrap(err, "gate: could not encode request body")
+		}
+		body = buf
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+endpoint, body)
+	if err != nil {
+		return errors.Wrap(err, "gate: could not create request")
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "gate: %s %s failed", method, endpoint)
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "gate: could not read response from %s %s", method, endpoint)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("gate: %s %s returned status %d: %s", method, endpoint, resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	if out == nil || len(content) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(content, out); err != nil {
+		return errors.Wrapf(err, "gate: could not decode response from %s %s", method, endpoint)
+	}
+
+	return nil
+}
+
+func validatePipeline(sp *types.SpinnakerPipeline) error {
+	if sp.Application == "" {
+		return ErrMissingApplication
+	}
+	if sp.Name == "" {
+		return ErrMissingName
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package gate_test
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
+	"github.com/namely/k8s-pipeliner/pipeline/gate"
+)
+
+// fakeGate is a minimal stand-in for the Spinnaker Gate API that stores
+// pipelines in memory
+type fakeGate struct {
+	pipelines []map[string]interface{}
+	saved     []map[string]interface{}
+	auth      []string
+}
+
+func (fg *fakeGate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fg.auth = append(fg.auth, r.Header.Get("Authorization"))
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/applications/nginx/pipelineConfigs":
+		json.NewEncoder(w).Encode(fg.pipelines)
+	case r.Method == http.MethodGet && r.URL.Path == "/applications/broken/pipelineConfigs":
+		http.Error(w, "kaboom", http.StatusInternalServerError)
+	case r.Method == http.MethodPost && r.URL.Path == "/pipelines":
+		var p map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fg.saved = append(fg.saved, p)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeGate() (*fakeGate, *httptest.Server) {
+	fg := &fakeGate{
+		pipelines: []map[string]interface{}{
+			{"id": "1234-abcd", "name": "Deploy nginx", "application": "nginx", "updateTs": "1580000000000"},
+			{"id": "5678-efgh", "name": "Rollback nginx", "application": "nginx"},
+		},
+	}
+
+	return fg, httptest.NewServer(fg)
+}
+
+func newClient(t *testing.T, baseURL string, opts ...gate.OptFunc) *gate.Client {
+	c, err := gate.NewClient(baseURL, opts...)
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestPipelineConfig(t *testing.T) {
+	_, srv := newFakeGate()
+	defer srv.Close()
+
+	c := newClient(t, srv.URL)
+
+	t.Run("Existing pipelines are returned by name", func(t *testing.T) {
+		cfg, err := c.PipelineConfig("nginx", "Rollback nginx")
+		require.NoError(t, err)
+		assert.Equal(t, "5678-efgh", cfg["id"])
+	})
+
+	t.Run("Missing pipelines return ErrPipelineNotFound", func(t *testing.T) {
+		_, err := c.PipelineConfig("nginx", "Does not exist")
+		assert.Equal(t, gate.ErrPipelineNotFound, err)
+	})
+
+	t.Run("Gate errors are surfaced", func(t *testing.T) {
+		_, err := c.PipelineConfig("broken", "Deploy nginx")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "status 500")
+		assert.Contains(t, err.Error(), "kaboom")
+	})
+}
+
+func TestUpsertPipeline(t *testing.T) {
+	t.Run("Existing pipeline IDs are reused", func(t *testing.T) {
+		fg, srv := newFakeGate()
+		defer srv.Close()
+
+		sp := &types.SpinnakerPipeline{Application: "nginx", Name: "Deploy nginx"}
+		err := newClient(t, srv.URL).UpsertPipeline(sp)
+		require.NoError(t, err)
+
+		assert.Equal(t, "1234-abcd", sp.ID)
+		require.Len(t, fg.saved, 1)
+		assert.Equal(t, "1234-abcd", fg.saved[0]["id"])
+		assert.Equal(t, "Deploy nginx", fg.saved[0]["name"])
+	})
+
+	t.Run("New pipelines are saved without an ID", func(t *testing.T) {
+		fg, srv := newFakeGate()
+		defer srv.Close()
+
+		sp := &types.SpinnakerPipeline{Application: "nginx", Name: "Brand new"}
+		err := newClient(t, srv.URL).UpsertPipeline(sp)
+		require.NoError(t, err)
+
+		require.Len(t, fg.saved, 1)
+		_, hasID := fg.saved[0]["id"]
+		assert.False(t, hasID)
+	})
+
+	t.Run("Matching pipeline IDs are accepted", func(t *testing.T) {
+		fg, srv := newFakeGate()
+		defer srv.Close()
+
+		sp := &types.SpinnakerPipeline{ID: "1234-abcd", Application: "nginx", Name: "Deploy nginx"}
+		require.NoError(t, newClient(t, srv.URL).UpsertPipeline(sp))
+		require.Len(t, fg.saved, 1)
+	})
+
+	t.Run("Conflicting pipeline IDs are rejected", func(t *testing.T) {
+		fg, srv := newFakeGate()
+		defer srv.Close()
+
+		sp := &types.SpinnakerPipeline{ID: "9999-zzzz", Application: "nginx", Name: "Deploy nginx"}
+		err := newClient(t, srv.URL).UpsertPipeline(sp)
+		require.Error(t, err)
+		assert.Equal(t, gate.ErrPipelineIDConflict, errors.Cause(err))
+		assert.Empty(t, fg.saved)
+	})
+
+	t.Run("Derived pipeline IDs adopt the saved ID", func(t *testing.T) {
+		fg, srv := newFakeGate()
+		defer srv.Close()
+
+		sp := &types.SpinnakerPipeline{ID: "9999-zzzz", Application: "nginx", Name: "Deploy nginx"}
+		require.NoError(t, newClient(t, srv.URL, gate.WithAdoptSavedID(true)).UpsertPipeline(sp))
+		require.Len(t, fg.saved, 1)
+		assert.Equal(t, "1234-abcd", fg.saved[0]["id"])
+	})
+
+	t.Run("Pipelines without a name or application are rejected", func(t *testing.T) {
+		fg, srv := newFakeGate()
+		defer srv.Close()
+
+		c := newClient(t, srv.URL)
+		assert.Equal(t, gate.ErrMissingApplication, c.UpsertPipeline(&types.SpinnakerPipeline{Name: "Deploy nginx"}))
+		assert.Equal(t, gate.ErrMissingName, c.UpsertPipeline(&types.SpinnakerPipeline{Application: "nginx"}))
+		assert.Empty(t, fg.saved)
+	})
+
+	t.Run("Bearer tokens are sent on every request", func(t *testing.T) {
+		fg, srv := newFakeGate()
+		defer srv.Close()
+
+		sp := &types.SpinnakerPipeline{Application: "nginx", Name: "Deploy nginx"}
+		err := newClient(t, srv.URL, gate.WithBearerToken("s3cr3t")).UpsertPipeline(sp)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"Bearer s3cr3t", "Bearer s3cr3t"}, fg.auth)
+	})
+}
+
+func TestClientCertificates(t *testing.T) {
+	fg := &fakeGate{}
+	var peers []int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peers = append(peers, len(r.TLS.PeerCertificates))
+		fg.ServeHTTP(w, r)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the certificate of the server is good enough to authenticate with it
+	cert := srv.TLS.Certificates[0]
+
+	t.Run("Client certificates are sent whatever the order of the options", func(t *testing.T) {
+		for _, opts := range [][]gate.OptFunc{
+			{gate.WithHTTPClient(srv.Client()), gate.WithClientCertificate(cert)},
+			{gate.WithClientCertificate(cert), gate.WithHTTPClient(srv.Client())},
+		} {
+			peers = nil
+			_, err := newClient(t, srv.URL, opts...).PipelineConfig("nginx", "Deploy nginx")
+			assert.Equal(t, gate.ErrPipelineNotFound, err)
+			assert.Equal(t, []int{1}, peers)
+		}
+	})
+
+	t.Run("Requests without a client certificate are refused", func(t *testing.T) {
+		_, err := newClient(t, srv.URL, gate.WithHTTPClient(srv.Client())).PipelineConfig("nginx", "Deploy nginx")
+		assert.Error(t, err)
+	})
+
+	t.Run("The configured HTTP client is not modified", func(t *testing.T) {
+		hc := srv.Client()
+		transport := hc.Transport
+
+		newClient(t, srv.URL, gate.WithHTTPClient(hc), gate.WithClientCertificate(cert))
+		assert.Equal(t, transport, hc.Transport)
+		assert.Empty(t, hc.Transport.(*http.Transport).TLSClientConfig.Certificates)
+	})
+
+	t.Run("Certificates can't be added to other transports", func(t *testing.T) {
+		hc := &http.Client{Transport: roundTripper(http.DefaultTransport.RoundTrip)}
+
+		_, err := gate.NewClient(srv.URL, gate.WithHTTPClient(hc), gate.WithClientCertificate(cert))
+		assert.Equal(t, gate.ErrCertificateTransport, errors.Cause(err))
+	})
+}
+
+// roundTripper is an http.RoundTripper that is not an *http.Transport
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (rt roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return rt(r)
+}
@@ -0,0 +1,43 @@
+package gate
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// OptFunc is used to assign configuration values to a Gate client
+type OptFunc func(c *Client)
+
+// WithBearerToken authenticates every request with the given bearer token
+func WithBearerToken(token string) OptFunc {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithClientCertificate authenticates with Gate using a client certificate
+// (x509 authentication), the certificate is added to the transport of the
+// HTTP client whatever the order of the options. NewClient fails when the
+// transport is not an *http.Transport.
+func WithClientCertificate(cert tls.Certificate) OptFunc {
+	return func(c *Client) {
+		c.certificates = append(c.certificates, cert)
+	}
+}
+
+// WithHTTPClient replaces the HTTP client used to talk to Gate, its timeout
+// is used instead of DefaultTimeout
+func WithHTTPClient(hc *http.Client) OptFunc {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithAdoptSavedID makes the client take over the ID of the pipeline saved in
+// Spinnaker instead of failing with ErrPipelineIDConflict, for pipelines with
+// an ID that was derived rather than chosen, ie: a deterministic ID
+func WithAdoptSavedID(adopt bool) OptFunc {
+	return func(c *Client) {
+		c.adoptSavedID = adopt
+	}
+}
@@ -0,0 +1,698 @@
+// Package importer reverse engineers pipeline.yml configuration from an
+// existing spinnaker pipeline JSON
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// apiVersions is used to write stub manifests for delete stages, since spinnaker
+// only keeps the kind and the name of the resource
+var apiVersions = map[string]string{
+	"configmap":               "v1",
+	"cronjob":                 "batch/v1beta1",
+	"daemonset":               "apps/v1",
+	"deployment":              "apps/v1",
+	"horizontalpodautoscaler": "autoscaling/v1",
+	"ingress":                 "networking.k8s.io/v1beta1",
+	"job":                     "batch/v1",
+	"persistentvolumeclaim":   "v1",
+	"pod":                     "v1",
+	"poddisruptionbudget":     "policy/v1beta1",
+	"replicaset":              "apps/v1",
+	"secret":                  "v1",
+	"service":                 "v1",
+	"serviceaccount":          "v1",
+	"statefulset":             "apps/v1",
+}
+
+// Result contains the imported pipeline config and the manifest files that
+// were extracted from it
+type Result struct {
+	Pipeline *config.Pipeline
+
+	// Manifests maps the path (relative to the pipeline file) of every extracted
+	// manifest to its YAML content
+	Manifests map[string][]byte
+
+	// Unsupported describes every stage, trigger, expected artifact and artifact
+	// binding that could not be translated
+	Unsupported []string
+}
+
+// MarshalPipeline renders the imported pipeline config as YAML, leaving out
+// empty values so the output reads like a hand written pipeline.yml
+func (r *Result) MarshalPipeline() ([]byte, error) {
+	content, err := yaml.Marshal(r.Pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var ms yaml.MapSlice
+	if err := yaml.Unmarshal(content, &ms); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(pruneEmpty(ms))
+}
+
+// Importer translates spinnaker pipeline JSON into a pipeline config
+type Importer struct {
+	manifestDir string
+
+	result *Result
+	// artifacts maps the ids of the imported expected artifacts to their type
+	artifacts map[string]string
+}
+
+// New initializes an importer that extracts manifests into the given
+// directory (relative to the generated pipeline file)
+func New(manifestDir string) *Importer {
+	return &Importer{manifestDir: manifestDir}
+}
+
+// Import parses spinnaker pipeline JSON into a pipeline config
+func (im *Importer) Import(content []byte) (*Result, error) {
+	var sp spinnakerPipeline
+	if err := json.Unmarshal(content, &sp); err != nil {
+		return nil, errors.Wrap(err, "importer: could not decode pipeline JSON")
+	}
+
+	im.result = &Result{
+		Pipeline: &config.Pipeline{
+			ID:                          sp.ID,
+			Name:                        sp.Name,
+			Application:                 sp.Application,
+			Description:                 sp.Description,
+			DisableConcurrentExecutions: sp.LimitConcurrent,
+			KeepQueuedPipelines:         sp.KeepWaitingPipelines,
+			Notifications:               importNotifications(sp.Notifications),
+		},
+		Manifests: make(map[string][]byte),
+	}
+	im.artifacts = make(map[string]string)
+	p := im.result.Pipeline
+	p.ExpectedArtifacts = im.importExpectedArtifacts(sp.ExpectedArtifacts)
+
+	for _, param := range sp.Parameters {
+		cp := config.Parameter{
+			Name:        param.Name,
+			Description: param.Description,
+			Default:     param.Default,
+			Required:    param.Required,
+		}
+		for _, o := range param.Options {
+			cp.Options = append(cp.Options, config.Option{Value: o.Value})
+		}
+		p.Parameters = append(p.Parameters, cp)
+	}
+
+	for i, raw := range sp.Triggers {
+		var t trigger
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, errors.Wrapf(err, "importer: could not decode trigger %d", i)
+		}
+		owner := fmt.Sprintf("trigger %d", i)
+
+		switch t.Type {
+		case builder.JenkinsTrigger:
+			enabled := t.Enabled
+			p.Triggers = append(p.Triggers, config.Trigger{
+				Jenkins: &config.JenkinsTrigger{
+					Job:          t.Job,
+					Master:       t.Master,
+					PropertyFile: t.PropertyFile,
+					Enabled:      &enabled,
+
+					ExpectedArtifactIDs: im.artifactIDs(owner, t.ExpectedArtifactIDs),
+				},
+			})
+		case builder.WebhookTrigger:
+			p.Triggers = append(p.Triggers, config.Trigger{
+				Webhook: &config.WebhookTrigger{
+					Enabled: t.Enabled,
+					Source:  t.Source,
+
+					ExpectedArtifactIDs: im.artifactIDs(owner, t.ExpectedArtifactIDs),
+				},
+			})
+		case builder.DockerTrigger:
+			enabled := t.Enabled
+			p.Triggers = append(p.Triggers, config.Trigger{
+				Docker: &config.DockerTrigger{
+					Account:      t.Account,
+					Organization: t.Organization,
+					Registry:     t.Registry,
+					Repository:   t.Repository,
+					Tag:          t.Tag,
+					Enabled:      &enabled,
+
+					ExpectedArtifactIDs: im.artifactIDs(owner, t.ExpectedArtifactIDs),
+				},
+			})
+		case builder.GitTrigger:
+			enabled := t.Enabled
+			p.Triggers = append(p.Triggers, config.Trigger{
+				Git: &config.GitTrigger{
+					Source:              t.Source,
+					Project:             t.Project,
+					Slug:                t.Slug,
+					Branch:              t.Branch,
+					Secret:              t.Secret,
+					ExpectedArtifactIDs: im.artifactIDs(owner, t.ExpectedArtifactIDs),
+					Enabled:             &enabled,
+				},
+			})
+		case builder.CronTrigger:
+			enabled := t.Enabled
+			p.Triggers = append(p.Triggers, config.Trigger{
+				Cron: &config.CronTrigger{
+					Expression:          t.CronExpression,
+					TimeZone:            t.CronTimeZone,
+					ExpectedArtifactIDs: im.artifactIDs(owner, t.ExpectedArtifactIDs),
+					Enabled:             &enabled,
+				},
+			})
+		case builder.PipelineTrigger:
+			enabled := t.Enabled
+			p.Triggers = append(p.Triggers, config.Trigger{
+				Pipeline: &config.PipelineTrigger{
+					Application:         t.Application,
+					Pipeline:            t.Pipeline,
+					Status:              t.Status,
+					ExpectedArtifactIDs: im.artifactIDs(owner, t.ExpectedArtifactIDs),
+					Enabled:             &enabled,
+				},
+			})
+		case builder.PubSubTrigger:
+			enabled := t.Enabled
+			p.Triggers = append(p.Triggers, config.Trigger{
+				PubSub: &config.PubSubTrigger{
+					System:               t.PubSubSystem,
+					Subscription:         t.SubscriptionName,
+					PayloadConstraints:   t.PayloadConstraints,
+					AttributeConstraints: t.AttributeConstraints,
+					ExpectedArtifactIDs:  im.artifactIDs(owner, t.ExpectedArtifactIDs),
+					Enabled:              &enabled,
+				},
+			})
+		default:
+			im.unsupported("trigger %d (%s)", i, t.Type)
+		}
+	}
+
+	for i, raw := range sp.Stages {
+		var meta stageMetadata
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, errors.Wrapf(err, "importer: could not decode stage %d", i)
+		}
+
+		stage, ok, err := im.importStage(meta, raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "importer: could not import stage %q", meta.Name)
+		}
+		if !ok {
+			im.unsupported("stage %s %q (%s)", meta.RefID, meta.Name, meta.Type)
+			continue
+		}
+
+		p.Stages = append(p.Stages, stage)
+	}
+
+	return im.result, nil
+}
+
+func (im *Importer) importStage(meta stageMetadata, raw json.RawMessage) (config.Stage, bool, error) {
+	s := config.Stage{
+		Account:       meta.Account,
+		Name:          meta.Name,
+		RefID:         meta.RefID,
+		ReliesOn:      meta.RequisiteStageRefIds,
+		Notifications: importNotifications(meta.Notifications),
+	}
+	if meta.StageEnabled != nil {
+		s.Condition = meta.StageEnabled.Expression
+	}
+
+	var err error
+	switch strings.ToLower(meta.Type) {
+	case "deploymanifest":
+		s.DeployEmbeddedManifests, err = im.importDeployManifest(meta, raw)
+		if err == nil && s.DeployEmbeddedManifests == nil {
+			return s, false, nil
+		}
+	case "deletemanifest":
+		s.DeleteEmbeddedManifest, err = im.importDeleteManifest(raw)
+		if err == nil && s.DeleteEmbeddedManifest == nil {
+			return s, false, nil
+		}
+	case "scalemanifest":
+		s.ScaleManifest, err = importScaleManifest(raw)
+	case "manualjudgment":
+		s.ManualJudgement, err = im.importManualJudgement(meta, raw)
+	case "jenkins":
+		s.Jenkins, err = importJenkins(raw)
+	case "pipeline":
+		s.RunSpinnakerPipeline, err = importRunSpinnakerPipeline(raw)
+	case "webhook":
+		s.WebHook, err = importWebhook(meta, raw)
+	case "evaluatevariables":
+		s.EvaluateVariables, err = importEvaluateVariables(raw)
+	default:
+		return s, false, nil
+	}
+
+	return s, err == nil, err
+}
+
+func (im *Importer) importDeployManifest(meta stageMetadata, raw json.RawMessage) (*config.DeployEmbeddedManifests, error) {
+	var ms manifestStage
+	if err := json.Unmarshal(raw, &ms); err != nil {
+		return nil, err
+	}
+
+	// only embedded (text) manifests and the manifests of imported expected
+	// artifacts can be represented in a pipeline.yml
+	switch ms.Source {
+	case "", "text":
+	case "artifact":
+		if t, ok := im.artifacts[ms.ManifestArtifactID]; !ok || t == builder.DockerImageArtifact {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	dem := &config.DeployEmbeddedManifests{
+		CompleteOtherBranchesThenFail: ms.CompleteOtherBranchesThenFail,
+		ContinuePipeline:              ms.ContinuePipeline,
+		FailPipeline:                  ms.FailPipeline,
+		MarkUnstableAsSuccessful:      ms.MarkUnstableAsSuccessful,
+		WaitForCompletion:             ms.WaitForCompletion,
+		StageTimeoutMS:                ms.StageTimeoutMS,
+		RequiredArtifactIDs:           im.artifactIDs(fmt.Sprintf("stage %s", meta.RefID), ms.RequiredArtifactIDs),
+	}
+	if ms.Source == "artifact" {
+		dem.ManifestArtifactID = ms.ManifestArtifactID
+	}
+
+	if m := ms.Moniker; m.Cluster != "" || m.Detail != "" || m.Stack != "" || (m.App != "" && m.App != im.result.Pipeline.Application) {
+		dem.DefaultMoniker = &config.Moniker{
+			App:     m.App,
+			Cluster: m.Cluster,
+			Detail:  m.Detail,
+			Stack:   m.Stack,
+		}
+	}
+
+	for _, manifest := range ms.Manifests {
+		content, err := k8syaml.Marshal(manifest)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not convert manifest to YAML")
+		}
+
+		kind, _ := manifest["kind"].(string)
+		metadata, _ := manifest["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+
+		file := im.addManifest(kind, name, content)
+		dem.Files = append(dem.Files, config.ManifestFile{File: file})
+	}
+
+	return dem, nil
+}
+
+func (im *Importer) importDeleteManifest(raw json.RawMessage) (*config.DeleteEmbeddedManifest, error) {
+	var ds deleteManifestStage
+	if err := json.Unmarshal(raw, &ds); err != nil {
+		return nil, err
+	}
+
+	// deletes by label selector can not be expressed with a single manifest file
+	parts := strings.Fields(ds.ManifestName)
+	if len(parts) != 2 {
+		return nil, nil
+	}
+	kind, name := parts[0], parts[1]
+
+	apiVersion, ok := apiVersions[strings.ToLower(kind)]
+	if !ok {
+		apiVersion = "v1"
+	}
+
+	stub := map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": ds.Location,
+		},
+	}
+	content, err := k8syaml.Marshal(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &config.DeleteEmbeddedManifest{
+		File:                          im.addManifest(kind, name, content),
+		CompleteOtherBranchesThenFail: ds.CompleteOtherBranchesThenFail,
+		ContinuePipeline:              ds.ContinuePipeline,
+		FailPipeline:                  ds.FailPipeline,
+		MarkUnstableAsSuccessful:      ds.MarkUnstableAsSuccessful,
+		WaitForCompletion:             ds.WaitForCompletion,
+	}, nil
+}
+
+func importScaleManifest(raw json.RawMessage) (*config.ScaleManifest, error) {
+	var ss scaleManifestStage
+	if err := json.Unmarshal(raw, &ss); err != nil {
+		return nil, err
+	}
+
+	name := ss.ManifestName
+	if parts := strings.Fields(ss.ManifestName); len(parts) == 2 {
+		name = parts[1]
+	}
+
+	return &config.ScaleManifest{
+		Kind:                          ss.Kind,
+		Name:                          name,
+		Namespace:                     ss.Location,
+		Replicas:                      ss.Replicas,
+		CompleteOtherBranchesThenFail: ss.CompleteOtherBranchesThenFail,
+		ContinuePipeline:              ss.ContinuePipeline,
+		FailPipeline:                  ss.FailPipeline,
+		MarkUnstableAsSuccessful:      ss.MarkUnstableAsSuccessful,
+		WaitForCompletion:             ss.WaitForCompletion,
+	}, nil
+}
+
+func (im *Importer) importManualJudgement(meta stageMetadata, raw json.RawMessage) (*config.ManualJudgementStage, error) {
+	var mj manualJudgementStage
+	if err := json.Unmarshal(raw, &mj); err != nil {
+		return nil, err
+	}
+
+	mjs := &config.ManualJudgementStage{
+		FailPipeline: mj.FailPipeline,
+		Instructions: mj.Instructions,
+		Inputs:       mj.Inputs,
+	}
+	for _, input := range mj.JudgmentInputs {
+		mjs.Inputs = append(mjs.Inputs, input.Value)
+	}
+	// pipeline.yml timeouts are in hours, other timeouts are rounded up
+	if mj.OverrideTimeout && mj.StageTimeoutMS > 0 {
+		mjs.Timeout = int((mj.StageTimeoutMS + builder.HourInMS - 1) / builder.HourInMS)
+		if mj.StageTimeoutMS%builder.HourInMS != 0 {
+			im.unsupported("stage %s %q: timeout of %s rounded up to %dh", meta.RefID, meta.Name, time.Duration(mj.StageTimeoutMS)*time.Millisecond, mjs.Timeout)
+		}
+	}
+
+	return mjs, nil
+}
+
+func importJenkins(raw json.RawMessage) (*config.JenkinsStage, error) {
+	var js jenkinsStage
+	if err := json.Unmarshal(raw, &js); err != nil {
+		return nil, err
+	}
+
+	return &config.JenkinsStage{
+		Job:                           js.Job,
+		Master:                        js.Master,
+		Parameters:                    passthroughParameters(js.Parameters),
+		CompleteOtherBranchesThenFail: js.CompleteOtherBranchesThenFail,
+		ContinuePipeline:              js.ContinuePipeline,
+		FailPipeline:                  js.FailPipeline,
+		MarkUnstableAsSuccessful:      js.MarkUnstableAsSuccessful,
+		WaitForCompletion:             js.WaitForCompletion,
+	}, nil
+}
+
+func importRunSpinnakerPipeline(raw json.RawMessage) (*config.RunSpinnakerPipelineStage, error) {
+	var ps pipelineStage
+	if err := json.Unmarshal(raw, &ps); err != nil {
+		return nil, err
+	}
+
+	return &config.RunSpinnakerPipelineStage{
+		Application:                   ps.Application,
+		Pipeline:                      ps.Pipeline,
+		PipelineParameters:            passthroughParameters(ps.PipelineParameters),
+		CompleteOtherBranchesThenFail: ps.CompleteOtherBranchesThenFail,
+		ContinuePipeline:              ps.ContinuePipeline,
+		FailPipeline:                  ps.FailPipeline,
+		MarkUnstableAsSuccessful:      ps.MarkUnstableAsSuccessful,
+		WaitForCompletion:             ps.WaitForCompletion,
+		StageTimeoutMS:                ps.StageTimeoutMS,
+	}, nil
+}
+
+func importWebhook(meta stageMetadata, raw json.RawMessage) (*config.WebHookStage, error) {
+	var ws webhookStage
+	if err := json.Unmarshal(raw, &ws); err != nil {
+		return nil, err
+	}
+
+	// the payload is a string in pipeline.yml but spinnaker allows any JSON value
+	var payload string
+	if len(ws.Payload) > 0 && string(ws.Payload) != "null" {
+		if err := json.Unmarshal(ws.Payload, &payload); err != nil {
+			payload = string(ws.Payload)
+		}
+	}
+
+	// headers are lists in pipeline.yml but spinnaker also accepts single values
+	var headers map[string][]string
+	for name, value := range ws.CustomHeaders {
+		if headers == nil {
+			headers = make(map[string][]string)
+		}
+
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				headers[name] = append(headers[name], fmt.Sprintf("%v", item))
+			}
+		default:
+			headers[name] = []string{fmt.Sprintf("%v", v)}
+		}
+	}
+
+	return &config.WebHookStage{
+		Name:          meta.Name,
+		Description:   ws.Description,
+		Method:        ws.Method,
+		URL:           ws.URL,
+		CustomHeaders: headers,
+		Payload:       payload,
+	}, nil
+}
+
+func importEvaluateVariables(raw json.RawMessage) (*config.EvaluateVariablesStage, error) {
+	var ev evaluateVariablesStage
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return nil, err
+	}
+
+	evs := &config.EvaluateVariablesStage{}
+
+	// spinnaker stores variables as a list of key/value pairs while older
+	// k8s-pipeliner output used a map
+	var list []config.PassthroughParameter
+	if err := json.Unmarshal(ev.Variables, &list); err == nil {
+		evs.Variables = list
+		return evs, nil
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal(ev.Variables, &m); err != nil {
+		return nil, errors.Wrap(err, "could not decode variables")
+	}
+	evs.Variables = passthroughParameters(m)
+
+	return evs, nil
+}
+
+// importExpectedArtifacts translates the expected artifacts of a pipeline,
+// artifacts the builder can't represent are reported as unsupported
+func (im *Importer) importExpectedArtifacts(artifacts []expectedArtifact) []config.ExpectedArtifact {
+	var imported []config.ExpectedArtifact
+	for _, ea := range artifacts {
+		types := []string{ea.MatchArtifact.Type}
+		if ea.UseDefaultArtifact && ea.DefaultArtifact != nil {
+			types = append(types, ea.DefaultArtifact.Type)
+		}
+
+		supported := true
+		for _, t := range types {
+			if !builder.IsArtifactType(t) {
+				im.unsupported("expected artifact %s (%s)", ea.ID, t)
+				supported = false
+				break
+			}
+		}
+		if _, ok := im.artifacts[ea.ID]; ok {
+			im.unsupported("expected artifact %s (duplicate id)", ea.ID)
+			supported = false
+		}
+		if !supported {
+			continue
+		}
+
+		cea := config.ExpectedArtifact{
+			ID:               ea.ID,
+			DisplayName:      ea.DisplayName,
+			Match:            importArtifact(ea.MatchArtifact),
+			UsePriorArtifact: ea.UsePriorArtifact,
+		}
+		if ea.UseDefaultArtifact && ea.DefaultArtifact != nil {
+			def := importArtifact(*ea.DefaultArtifact)
+			cea.Default = &def
+		}
+
+		im.artifacts[ea.ID] = ea.MatchArtifact.Type
+		imported = append(imported, cea)
+	}
+
+	return imported
+}
+
+func importArtifact(a artifact) config.Artifact {
+	return config.Artifact{
+		Type:      a.Type,
+		Name:      a.Name,
+		Reference: a.Reference,
+		Version:   a.Version,
+		Account:   a.ArtifactAccount,
+	}
+}
+
+// artifactIDs returns the bindings of a trigger or stage to imported expected
+// artifacts, bindings to other artifacts are reported as unsupported
+func (im *Importer) artifactIDs(owner string, ids []string) []string {
+	var kept []string
+	for _, id := range ids {
+		if _, ok := im.artifacts[id]; !ok {
+			im.unsupported("%s: expected artifact %s", owner, id)
+			continue
+		}
+		kept = append(kept, id)
+	}
+
+	return kept
+}
+
+// addManifest registers an extracted manifest and returns its path. Identical
+// manifests used by several stages are only written once.
+func (im *Importer) addManifest(kind, name string, content []byte) string {
+	base := strings.ToLower(kind)
+	if name != "" {
+		base = base + "-" + strings.ToLower(name)
+	}
+
+	file := path.Join(im.manifestDir, base+".yml")
+	for i := 2; ; i++ {
+		existing, ok := im.result.Manifests[file]
+		if !ok || string(existing) == string(content) {
+			break
+		}
+		file = path.Join(im.manifestDir, fmt.Sprintf("%s-%d.yml", base, i))
+	}
+
+	im.result.Manifests[file] = content
+	return file
+}
+
+func (im *Importer) unsupported(format string, args ...interface{}) {
+	im.result.Unsupported = append(im.result.Unsupported, fmt.Sprintf(format, args...))
+}
+
+func importNotifications(notifications []notification) []config.Notification {
+	var nots []config.Notification
+	for _, n := range notifications {
+		cn := config.Notification{
+			Address: n.Address,
+			Level:   n.Level,
+			Type:    n.Type,
+			When:    n.When,
+		}
+		if len(n.Message) > 0 {
+			cn.Message = make(map[string]string, len(n.Message))
+			for on, msg := range n.Message {
+				cn.Message[on] = msg.Text
+			}
+		}
+		nots = append(nots, cn)
+	}
+
+	return nots
+}
+
+func passthroughParameters(m map[string]string) []config.PassthroughParameter {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var params []config.PassthroughParameter
+	for _, k := range keys {
+		params = append(params, config.PassthroughParameter{Key: k, Value: m[k]})
+	}
+
+	return params
+}
+
+// pruneEmpty removes nil values, empty strings and empty collections from
+// decoded YAML. Booleans and numbers are kept since false and 0 can differ
+// from the builder defaults.
+func pruneEmpty(v interface{}) interface{} {
+	switch t := v.(type) {
+	case yaml.MapSlice:
+		out := yaml.MapSlice{}
+		for _, item := range t {
+			val := pruneEmpty(item.Value)
+			if isEmpty(val) {
+				continue
+			}
+			out = append(out, yaml.MapItem{Key: item.Key, Value: val})
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(t))
+		for _, item := range t {
+			out = append(out, pruneEmpty(item))
+		}
+		return out
+	}
+
+	return v
+}
+
+func isEmpty(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case yaml.MapSlice:
+		return len(t) == 0
+	case []interface{}:
+		return len(t) == 0
+	}
+
+	return false
+}
@@ -0,0 +1,311 @@
+package importer_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/namely/k8s-pipeliner/pipeline/diff"
+	"github.com/namely/k8s-pipeliner/pipeline/importer"
+)
+
+func TestImport(t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "pipeline.json"))
+	require.NoError(t, err)
+
+	result, err := importer.New("manifests").Import(content)
+	require.NoError(t, err)
+
+	p := result.Pipeline
+	assert.Equal(t, "6c1f7a36-0d4f-4b6e-9d52-5a1c3e2f8b10", p.ID)
+	assert.Equal(t, "Deploy nginx", p.Name)
+	assert.Equal(t, "nginx", p.Application)
+	assert.True(t, p.DisableConcurrentExecutions)
+	require.Len(t, p.Parameters, 1)
+	assert.Equal(t, []config.Option{{Value: "latest"}, {Value: "stable"}}, p.Parameters[0].Options)
+	require.Len(t, p.Notifications, 1)
+	assert.Equal(t, "nginx failed to deploy", p.Notifications[0].Message["pipeline.failed"])
+
+	t.Run("Unsupported stages are reported", func(t *testing.T) {
+		assert.Equal(t, []string{
+			`stage 1 "Bake" (bakeManifest)`,
+			`stage 3 "Deploy from artifact" (deployManifest)`,
+		}, result.Unsupported)
+
+		require.Len(t, p.Triggers, 4)
+		assert.Equal(t, "nginx/job/master", p.Triggers[0].Jenkins.Job)
+		assert.Equal(t, "namely/nginx", p.Triggers[1].Docker.Repository)
+		assert.Equal(t, []string{"nginx-image"}, p.Triggers[1].Docker.ExpectedArtifactIDs)
+		assert.Equal(t, []string{"successful"}, p.Triggers[2].Pipeline.Status)
+		assert.Equal(t, "0 0 4 ? * MON-FRI", p.Triggers[3].Cron.Expression)
+		assert.False(t, *p.Triggers[3].Cron.Enabled)
+		require.Len(t, p.Stages, 8)
+	})
+
+	t.Run("Embedded manifests are extracted into files", func(t *testing.T) {
+		s := p.Stages[0]
+		require.NotNil(t, s.DeployEmbeddedManifests)
+		assert.Equal(t, "2", s.RefID)
+		assert.Equal(t, []string{"1"}, s.ReliesOn)
+		assert.Equal(t, "${ parameters.tag != 'stable' }", s.Condition)
+		assert.Equal(t, int64(600000), s.DeployEmbeddedManifests.StageTimeoutMS)
+		assert.Equal(t, &config.Moniker{App: "nginx", Stack: "web"}, s.DeployEmbeddedManifests.DefaultMoniker)
+		assert.Equal(t, []config.ManifestFile{
+			{File: "manifests/deployment-nginx.yml"},
+			{File: "manifests/service-nginx.yml"},
+		}, s.DeployEmbeddedManifests.Files)
+
+		assert.Contains(t, string(result.Manifests["manifests/deployment-nginx.yml"]), "replicas: 2")
+		assert.Contains(t, string(result.Manifests["manifests/service-nginx.yml"]), "port: 80")
+	})
+
+	t.Run("Manual judgements are translated", func(t *testing.T) {
+		mj := p.Stages[1].ManualJudgement
+		require.NotNil(t, mj)
+		assert.Equal(t, []string{"yes", "no"}, mj.Inputs)
+		assert.Equal(t, 2, mj.Timeout)
+		assert.True(t, mj.FailPipeline)
+	})
+
+	t.Run("Scale and delete stages are translated", func(t *testing.T) {
+		sm := p.Stages[2].ScaleManifest
+		require.NotNil(t, sm)
+		assert.Equal(t, "nginx-old", sm.Name)
+		assert.Equal(t, "web", sm.Namespace)
+
+		dm := p.Stages[3].DeleteEmbeddedManifest
+		require.NotNil(t, dm)
+		assert.Equal(t, "manifests/deployment-nginx-old.yml", dm.File)
+		assert.Contains(t, string(result.Manifests[dm.File]), "apiVersion: apps/v1")
+	})
+
+	t.Run("Jenkins, pipeline, webhook and variables stages are translated", func(t *testing.T) {
+		js := p.Stages[4].Jenkins
+		require.NotNil(t, js)
+		assert.Equal(t, []config.PassthroughParameter{{Key: "DEBUG", Value: "false"}, {Key: "ENV", Value: "int"}}, js.Parameters)
+		require.NotNil(t, js.ContinuePipeline)
+		assert.False(t, *js.ContinuePipeline)
+
+		rsp := p.Stages[5].RunSpinnakerPipeline
+		require.NotNil(t, rsp)
+		assert.Equal(t, "nginx-config", rsp.Application)
+
+		wh := p.Stages[6].WebHook
+		require.NotNil(t, wh)
+		assert.Equal(t, map[string][]string{"Content-Type": {"application/json"}}, wh.CustomHeaders)
+		assert.JSONEq(t, `{"service": "nginx"}`, wh.Payload)
+
+		ev := p.Stages[7].EvaluateVariables
+		require.NotNil(t, ev)
+		assert.Equal(t, []config.PassthroughParameter{{Key: "image", Value: "${trigger.properties.image}"}}, ev.Variables)
+	})
+
+	t.Run("Pipelines are marshalled without empty values", func(t *testing.T) {
+		out, err := result.MarshalPipeline()
+		require.NoError(t, err)
+
+		assert.NotContains(t, string(out), `""`)
+		assert.NotContains(t, string(out), "[]")
+
+		cfg, err := config.NewPipeline(bytes.NewReader(out))
+		require.NoError(t, err)
+		assert.Equal(t, p.Stages[0].DeployEmbeddedManifests.Files, cfg.Stages[0].DeployEmbeddedManifests.Files)
+	})
+}
+
+func TestImportManualJudgementTimeouts(t *testing.T) {
+	for _, tt := range []struct {
+		timeoutMS   int64
+		hours       int
+		unsupported []string
+	}{
+		{7200000, 2, nil},
+		{5400000, 2, []string{`stage 1 "Continue?": timeout of 1h30m0s rounded up to 2h`}},
+		{1800000, 1, []string{`stage 1 "Continue?": timeout of 30m0s rounded up to 1h`}},
+	} {
+		content := []byte(fmt.Sprintf(`{
+			"name": "Deploy nginx",
+			"application": "nginx",
+			"stages": [{"refId": "1", "name": "Continue?", "type": "manualJudgment", "overrideTimeout": true, "stageTimeoutMs": %d}]
+		}`, tt.timeoutMS))
+
+		result, err := importer.New("manifests").Import(content)
+		require.NoError(t, err)
+
+		assert.Equal(t, tt.hours, result.Pipeline.Stages[0].ManualJudgement.Timeout, "timeout of %dms", tt.timeoutMS)
+		assert.Equal(t, tt.unsupported, result.Unsupported)
+	}
+}
+
+// TestImportRoundTrip makes sure that a pipeline generated by the builder can
+// be imported and built again without changes
+func TestImportRoundTrip(t *testing.T) {
+	wd, _ := os.Getwd()
+	manifest := filepath.Join(wd, "..", "builder", "testdata", "nginx-deployment.yml")
+
+	original := &config.Pipeline{
+		Name:        "Deploy nginx",
+		Application: "nginx",
+		Triggers: []config.Trigger{
+			{Webhook: &config.WebhookTrigger{Enabled: true, Source: "nginx"}},
+		},
+		Stages: []config.Stage{
+			{
+				Account: "int-k8s",
+				Name:    "Deploy nginx",
+				DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+					Files: []config.ManifestFile{{File: manifest}},
+				},
+			},
+			{
+				Name: "Continue?",
+				ManualJudgement: &config.ManualJudgementStage{
+					FailPipeline: true,
+					Instructions: "Ship it?",
+					Timeout:      3,
+				},
+			},
+			{
+				Name: "Build",
+				Jenkins: &config.JenkinsStage{
+					Job:        "nginx",
+					Parameters: []config.PassthroughParameter{{Key: "ENV", Value: "int"}},
+				},
+			},
+		},
+	}
+
+	assertRoundTrip(t, original)
+}
+
+func TestImportArtifacts(t *testing.T) {
+	wd, _ := os.Getwd()
+	manifest := filepath.Join(wd, "..", "builder", "testdata", "nginx-deployment.yml")
+
+	t.Run("Expected artifacts and their bindings survive a round trip", func(t *testing.T) {
+		original := &config.Pipeline{
+			Name:        "Deploy nginx",
+			Application: "nginx",
+			ExpectedArtifacts: []config.ExpectedArtifact{
+				{
+					ID:          "nginx-image",
+					DisplayName: "nginx image",
+					Match:       config.Artifact{Type: "docker/image", Name: "registry.namely.land/namely/nginx"},
+					Default: &config.Artifact{
+						Type:      "docker/image",
+						Name:      "registry.namely.land/namely/nginx",
+						Reference: "registry.namely.land/namely/nginx:stable",
+						Account:   "namely-registry",
+					},
+				},
+				{
+					ID:               "nginx-manifest",
+					Match:            config.Artifact{Type: "github/file", Name: "manifests/nginx.yml", Account: "namely-github"},
+					UsePriorArtifact: true,
+				},
+			},
+			Triggers: []config.Trigger{
+				{Git: &config.GitTrigger{Source: "github", Project: "namely", Slug: "nginx", ExpectedArtifactIDs: []string{"nginx-manifest"}}},
+				{Docker: &config.DockerTrigger{Account: "namely-registry", Repository: "namely/nginx", ExpectedArtifactIDs: []string{"nginx-image"}}},
+				{Jenkins: &config.JenkinsTrigger{Job: "nginx/job/master", Master: "jenkins", ExpectedArtifactIDs: []string{"nginx-image"}}},
+				{Webhook: &config.WebhookTrigger{Enabled: true, Source: "nginx", ExpectedArtifactIDs: []string{"nginx-manifest"}}},
+			},
+			Stages: []config.Stage{
+				{
+					Account: "int-k8s",
+					Name:    "Deploy nginx",
+					DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+						Files:               []config.ManifestFile{{File: manifest}},
+						RequiredArtifactIDs: []string{"nginx-image"},
+					},
+				},
+				{
+					Account: "int-k8s",
+					Name:    "Deploy from github",
+					DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+						ManifestArtifactID:  "nginx-manifest",
+						RequiredArtifactIDs: []string{"nginx-image"},
+					},
+				},
+			},
+		}
+
+		result := assertRoundTrip(t, original)
+		assert.Equal(t, original.ExpectedArtifacts, result.Pipeline.ExpectedArtifacts)
+		assert.Equal(t, []string{"nginx-image"}, result.Pipeline.Triggers[1].Docker.ExpectedArtifactIDs)
+		assert.Equal(t, "nginx-manifest", result.Pipeline.Stages[1].DeployEmbeddedManifests.ManifestArtifactID)
+	})
+
+	t.Run("Artifacts that can't be imported are reported with their bindings", func(t *testing.T) {
+		content := []byte(`{
+			"name": "Deploy nginx",
+			"application": "nginx",
+			"expectedArtifacts": [
+				{"id": "config", "matchArtifact": {"type": "custom/object", "name": "config"}},
+				{"id": "manifest", "matchArtifact": {"type": "github/file", "name": "nginx.yml"}}
+			],
+			"triggers": [
+				{"type": "git", "enabled": true, "source": "github", "project": "namely", "slug": "nginx", "expectedArtifactIds": ["config", "manifest"]}
+			],
+			"stages": [
+				{"refId": "1", "name": "Deploy config", "type": "deployManifest", "account": "int-k8s", "source": "artifact", "manifestArtifactId": "config"},
+				{"refId": "2", "name": "Deploy", "type": "deployManifest", "account": "int-k8s", "source": "artifact", "manifestArtifactId": "manifest", "requiredArtifactIds": ["config"]}
+			]
+		}`)
+
+		result, err := importer.New("manifests").Import(content)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{
+			"expected artifact config (custom/object)",
+			"trigger 0: expected artifact config",
+			`stage 1 "Deploy config" (deployManifest)`,
+			"stage 2: expected artifact config",
+		}, result.Unsupported)
+		assert.Equal(t, []string{"manifest"}, result.Pipeline.Triggers[0].Git.ExpectedArtifactIDs)
+
+		_, err = builder.New(result.Pipeline).Pipeline()
+		assert.NoError(t, err)
+	})
+}
+
+// assertRoundTrip builds a pipeline, imports the JSON and makes sure the
+// imported pipeline builds the same JSON
+func assertRoundTrip(t *testing.T, original *config.Pipeline) *importer.Result {
+	first, err := builder.New(original, builder.WithLinear(true)).MarshalJSON()
+	require.NoError(t, err)
+
+	result, err := importer.New("manifests").Import(first)
+	require.NoError(t, err)
+	assert.Empty(t, result.Unsupported)
+
+	dir, err := ioutil.TempDir("", "importer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for file, content := range result.Manifests {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, file), content, 0644))
+	}
+
+	second, err := builder.New(result.Pipeline, builder.WithBasePath(dir)).MarshalJSON()
+	require.NoError(t, err)
+
+	var a, b map[string]interface{}
+	require.NoError(t, json.Unmarshal(first, &a))
+	require.NoError(t, json.Unmarshal(second, &b))
+
+	report := diff.Compare(b, a)
+	assert.True(t, report.Empty(), "round trip changed the pipeline: %+v", report)
+
+	return result
+}
@@ -0,0 +1,194 @@
+package importer
+
+import "encoding/json"
+
+// The types in this file decode the subset of spinnaker pipeline JSON that
+// can be translated into a pipeline config. They are separate from the builder
+// types since those only need to be marshalled and embed interfaces that can't
+// be decoded.
+
+type spinnakerPipeline struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	Application          string             `json:"application"`
+	Description          string             `json:"description"`
+	LimitConcurrent      bool               `json:"limitConcurrent"`
+	KeepWaitingPipelines bool               `json:"keepWaitingPipelines"`
+	Notifications        []notification     `json:"notifications"`
+	Parameters           []parameter        `json:"parameterConfig"`
+	Triggers             []json.RawMessage  `json:"triggers"`
+	Stages               []json.RawMessage  `json:"stages"`
+	ExpectedArtifacts    []expectedArtifact `json:"expectedArtifacts"`
+}
+
+type expectedArtifact struct {
+	ID                 string    `json:"id"`
+	DisplayName        string    `json:"displayName"`
+	MatchArtifact      artifact  `json:"matchArtifact"`
+	DefaultArtifact    *artifact `json:"defaultArtifact"`
+	UseDefaultArtifact bool      `json:"useDefaultArtifact"`
+	UsePriorArtifact   bool      `json:"usePriorArtifact"`
+}
+
+type artifact struct {
+	ArtifactAccount string `json:"artifactAccount"`
+	Type            string `json:"type"`
+	Name            string `json:"name"`
+	Reference       string `json:"reference"`
+	Version         string `json:"version"`
+}
+
+type parameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     string `json:"default"`
+	Required    bool   `json:"required"`
+	Options     []struct {
+		Value string `json:"value"`
+	} `json:"options"`
+}
+
+type notification struct {
+	Address string   `json:"address"`
+	Level   string   `json:"level"`
+	Type    string   `json:"type"`
+	When    []string `json:"when"`
+	Message map[string]struct {
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+type trigger struct {
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+
+	// jenkins
+	Job          string `json:"job"`
+	Master       string `json:"master"`
+	PropertyFile string `json:"propertyFile"`
+
+	// webhook
+	Source string `json:"source"`
+
+	// docker
+	Account      string `json:"account"`
+	Organization string `json:"organization"`
+	Registry     string `json:"registry"`
+	Repository   string `json:"repository"`
+	Tag          string `json:"tag"`
+
+	// git, the source is shared with webhooks
+	Project string `json:"project"`
+	Slug    string `json:"slug"`
+	Branch  string `json:"branch"`
+	Secret  string `json:"secret"`
+
+	// cron
+	CronExpression string `json:"cronExpression"`
+	CronTimeZone   string `json:"cronTimeZone"`
+
+	// pipeline
+	Application string   `json:"application"`
+	Pipeline    string   `json:"pipeline"`
+	Status      []string `json:"status"`
+
+	// pubsub
+	PubSubSystem         string            `json:"pubsubSystem"`
+	SubscriptionName     string            `json:"subscriptionName"`
+	PayloadConstraints   map[string]string `json:"payloadConstraints"`
+	AttributeConstraints map[string]string `json:"attributeConstraints"`
+
+	ExpectedArtifactIDs []string `json:"expectedArtifactIds"`
+}
+
+type stageMetadata struct {
+	Type                 string         `json:"type"`
+	Name                 string         `json:"name"`
+	RefID                string         `json:"refId"`
+	RequisiteStageRefIds []string       `json:"requisiteStageRefIds"`
+	Account              string         `json:"account"`
+	Notifications        []notification `json:"notifications"`
+	StageEnabled         *struct {
+		Expression string `json:"expression"`
+	} `json:"stageEnabled"`
+}
+
+type failureOptions struct {
+	CompleteOtherBranchesThenFail *bool `json:"completeOtherBranchesThenFail"`
+	ContinuePipeline              *bool `json:"continuePipeline"`
+	FailPipeline                  *bool `json:"failPipeline"`
+	MarkUnstableAsSuccessful      *bool `json:"markUnstableAsSuccessful"`
+	WaitForCompletion             *bool `json:"waitForCompletion"`
+}
+
+type manifestStage struct {
+	failureOptions
+
+	Source              string                   `json:"source"`
+	Manifests           []map[string]interface{} `json:"manifests"`
+	ManifestArtifactID  string                   `json:"manifestArtifactId"`
+	RequiredArtifactIDs []string                 `json:"requiredArtifactIds"`
+	StageTimeoutMS      int64                    `json:"stageTimeoutMs"`
+	Moniker             struct {
+		App     string `json:"app"`
+		Cluster string `json:"cluster"`
+		Detail  string `json:"detail"`
+		Stack   string `json:"stack"`
+	} `json:"moniker"`
+}
+
+type deleteManifestStage struct {
+	failureOptions
+
+	ManifestName string `json:"manifestName"`
+	Location     string `json:"location"`
+}
+
+type scaleManifestStage struct {
+	failureOptions
+
+	Kind         string `json:"kind"`
+	ManifestName string `json:"manifestName"`
+	Location     string `json:"location"`
+	Replicas     int    `json:"replicas"`
+}
+
+type manualJudgementStage struct {
+	FailPipeline    bool     `json:"failPipeline"`
+	Instructions    string   `json:"instructions"`
+	Inputs          []string `json:"inputs"`
+	OverrideTimeout bool     `json:"overrideTimeout"`
+	StageTimeoutMS  int64    `json:"stageTimeoutMs"`
+	JudgmentInputs  []struct {
+		Value string `json:"value"`
+	} `json:"judgmentInputs"`
+}
+
+type jenkinsStage struct {
+	failureOptions
+
+	Job        string            `json:"job"`
+	Master     string            `json:"master"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+type pipelineStage struct {
+	failureOptions
+
+	Application        string            `json:"application"`
+	Pipeline           string            `json:"pipeline"`
+	PipelineParameters map[string]string `json:"pipelineParameters"`
+	StageTimeoutMS     int64             `json:"stageTimeoutMs"`
+}
+
+type webhookStage struct {
+	Description   string                 `json:"description"`
+	Method        string                 `json:"method"`
+	URL           string                 `json:"url"`
+	CustomHeaders map[string]interface{} `json:"customHeaders"`
+	Payload       json.RawMessage        `json:"payload"`
+}
+
+type evaluateVariablesStage struct {
+	Variables json.RawMessage `json:"variables"`
+}
@@ -0,0 +1,95 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Cache stores content on disk by its digest
+type Cache struct {
+	dir string
+}
+
+// NewCache returns a cache that stores content in dir
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// DefaultCacheDir is in the cache directory of the user, ie:
+// ~/.cache/k8s-pipeliner/remote, or the temp directory without one
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "k8s-pipeliner", "remote")
+}
+
+// Digest returns the sha256 digest of content, ie: sha256:<hex>
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Get returns the content of a digest, ok is false when it is not cached.
+// Content that does not match its digest is treated as not cached.
+func (c *Cache) Get(digest string) ([]byte, bool, error) {
+	file, err := c.path(digest)
+	if err != nil {
+		return nil, false, err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return content, Digest(content) == digest, nil
+}
+
+// Put stores content by its digest, concurrent puts of the same content are safe
+func (c *Cache) Put(content []byte) error {
+	file, err := c.path(Digest(content))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return errors.Wrap(err, "could not create the remote cache")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "could not write to the remote cache")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "could not write to the remote cache")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "could not write to the remote cache")
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+func (c *Cache) path(digest string) (string, error) {
+	hexDigest := strings.TrimPrefix(digest, "sha256:")
+	if _, err := hex.DecodeString(hexDigest); err != nil || len(hexDigest) != sha256.Size*2 {
+		return "", errors.Errorf("remote: invalid digest %s", digest)
+	}
+
+	return filepath.Join(c.dir, "sha256", hexDigest), nil
+}
@@ -0,0 +1,91 @@
+package remote
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidGitRef is returned for git references without a repository and a path
+var ErrInvalidGitRef = errors.New("remote: git references look like git::<repo>//<path>?ref=<ref>")
+
+// GitResolver reads git::<repo>//<path>?ref=<ref> references with the git
+// binary, the ref is fetched without a checkout and defaults to HEAD
+type GitResolver struct{}
+
+// Resolve fetches the ref of the repository and reads the file at path
+func (r *GitResolver) Resolve(ref string) ([]byte, error) {
+	repo, file, rev, err := parseGitRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "k8s-pipeliner-git")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := git(dir, "init", "--quiet", "--bare"); err != nil {
+		return nil, err
+	}
+	if _, err := git(dir, "fetch", "--quiet", "--depth", "1", repo, rev); err != nil {
+		return nil, err
+	}
+
+	return git(dir, "show", "FETCH_HEAD:"+file)
+}
+
+// parseGitRef splits a git reference in the repository, the path in it and the ref
+func parseGitRef(ref string) (repo, file, rev string, err error) {
+	ref = strings.TrimPrefix(ref, "git::")
+
+	rev = "HEAD"
+	if i := strings.LastIndex(ref, "?"); i >= 0 {
+		query, err := url.ParseQuery(ref[i+1:])
+		if err != nil {
+			return "", "", "", errors.Wrap(ErrInvalidGitRef, err.Error())
+		}
+		if query.Get("ref") != "" {
+			rev = query.Get("ref")
+		}
+		ref = ref[:i]
+	}
+
+	// the path starts at the first // after the scheme of the repository
+	start := 0
+	if i := strings.Index(ref, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(ref[start:], "//")
+	if i < 0 {
+		return "", "", "", ErrInvalidGitRef
+	}
+
+	repo, file = ref[:start+i], ref[start+i+len("//"):]
+	// the repository and the ref must not be taken for options of git
+	if repo == "" || file == "" || strings.HasPrefix(repo, "-") || strings.HasPrefix(rev, "-") {
+		return "", "", "", ErrInvalidGitRef
+	}
+
+	return repo, file, rev, nil
+}
+
+func git(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,37 @@
+package remote
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPResolver downloads https:// references
+type HTTPResolver struct {
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// Resolve downloads the content of an https URL
+func (r *HTTPResolver) Resolve(ref string) ([]byte, error) {
+	resp, err := client(r.Client).Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func client(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+
+	return c
+}
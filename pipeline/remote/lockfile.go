@@ -0,0 +1,89 @@
+package remote
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Lockfile records the digests remote references resolved to, it is written
+// every time a reference is recorded by a fetcher that updates it. A nil
+// lockfile pins nothing.
+type Lockfile struct {
+	path string
+
+	mu      sync.Mutex
+	remotes map[string]LockedRemote
+}
+
+// LockedRemote is the entry of a reference in the lockfile
+type LockedRemote struct {
+	Digest string `yaml:"digest"`
+}
+
+type lockfileContent struct {
+	Remotes map[string]LockedRemote `yaml:"remotes"`
+}
+
+// LoadLockfile reads the lockfile at path, a missing file is an empty lockfile
+func LoadLockfile(path string) (*Lockfile, error) {
+	l := &Lockfile{path: path, remotes: map[string]LockedRemote{}}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lc lockfileContent
+	if err := yaml.UnmarshalStrict(content, &lc); err != nil {
+		return nil, errors.Wrapf(err, "could not decode lockfile %s", path)
+	}
+	if lc.Remotes != nil {
+		l.remotes = lc.Remotes
+	}
+
+	return l, nil
+}
+
+// Digest returns the digest a reference is locked to
+func (l *Lockfile) Digest(ref string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.remotes[ref]
+	return r.Digest, ok
+}
+
+// Record locks a reference to a digest and writes the lockfile
+func (l *Lockfile) Record(ref, digest string) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.remotes[ref] = LockedRemote{Digest: digest}
+
+	// yaml.v2 sorts the references, so the file only changes with them
+	content, err := yaml.Marshal(lockfileContent{Remotes: l.remotes})
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(l.path, content, 0644); err != nil {
+		return errors.Wrapf(err, "could not write lockfile %s", l.path)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const ociTitleAnnotation = "org.opencontainers.image.title"
+
+var (
+	// ErrInvalidOCIRef is returned for oci references without a registry and a repository
+	ErrInvalidOCIRef = errors.New("remote: oci references look like oci://<registry>/<repository>:<tag>//<file>")
+	// ErrNoOCILayer is returned when no layer of an OCI artifact matches the file of a reference
+	ErrNoOCILayer = errors.New("remote: no layer of the oci artifact matches the reference")
+)
+
+// OCIResolver downloads a layer of an OCI artifact, ie: pushed with oras,
+// through the registry API. The file of the reference selects the layer by its
+// title, it can be left out for artifacts with a single layer. Registries
+// that need a token are accessed anonymously.
+type OCIResolver struct {
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+type ociManifest struct {
+	Layers []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// Resolve downloads the layer of the artifact a reference points to
+func (r *OCIResolver) Resolve(ref string) ([]byte, error) {
+	registry, repository, tag, file, err := parseOCIRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	base := fmt.Sprintf("https://%s/v2/%s", registry, repository)
+	body, err := r.get(base+"/manifests/"+tag, "application/vnd.oci.image.manifest.v1+json")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch the oci manifest")
+	}
+
+	var m ociManifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, errors.Wrap(err, "could not decode the oci manifest")
+	}
+
+	digest := ""
+	for _, l := range m.Layers {
+		if l.Annotations[ociTitleAnnotation] == file || (file == "" && len(m.Layers) == 1) {
+			digest = l.Digest
+			break
+		}
+	}
+	if digest == "" {
+		return nil, errors.Wrap(ErrNoOCILayer, ref)
+	}
+
+	content, err := r.get(base+"/blobs/"+digest, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch the oci layer")
+	}
+	if strings.HasPrefix(digest, "sha256:") && Digest(content) != digest {
+		return nil, errors.Errorf("oci layer does not match its digest %s", digest)
+	}
+
+	return content, nil
+}
+
+// get requests a registry url, an anonymous token is requested when the
+// registry asks for one
+func (r *OCIResolver) get(u, accept string) ([]byte, error) {
+	resp, err := r.do(u, accept, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+
+		token, err := r.token(resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = r.do(u, accept, token); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (r *OCIResolver) do(u, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return client(r.Client).Do(req)
+}
+
+// token requests an anonymous token for a Bearer challenge
+func (r *OCIResolver) token(challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", errors.Errorf("unsupported registry authentication %q", challenge)
+	}
+
+	params := map[string]string{}
+	for _, p := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		if kv := strings.SplitN(strings.TrimSpace(p), "=", 2); len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", errors.Errorf("invalid registry authentication realm %q", params["realm"])
+	}
+	query := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			query.Set(k, params[k])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	resp, err := r.do(realm.String(), "", "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("could not get a registry token: %s", resp.Status)
+	}
+
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", errors.Wrap(err, "could not decode the registry token")
+	}
+	if t.Token == "" {
+		return t.AccessToken, nil
+	}
+
+	return t.Token, nil
+}
+
+// parseOCIRef splits an oci reference in the registry, the repository, the tag
+// or digest and the file
+func parseOCIRef(ref string) (registry, repository, tag, file string, err error) {
+	ref = strings.TrimPrefix(ref, "oci://")
+	if i := strings.Index(ref, "//"); i >= 0 {
+		ref, file = ref[:i], ref[i+len("//"):]
+	}
+
+	i := strings.Index(ref, "/")
+	if i <= 0 || i == len(ref)-1 {
+		return "", "", "", "", ErrInvalidOCIRef
+	}
+	registry, repository = ref[:i], ref[i+1:]
+
+	tag = "latest"
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository, tag = repository[:i], repository[i+1:]
+	} else if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+	if repository == "" || tag == "" {
+		return "", "", "", "", ErrInvalidOCIRef
+	}
+
+	return registry, repository, tag, file, nil
+}
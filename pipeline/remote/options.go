@@ -0,0 +1,41 @@
+package remote
+
+// OptFunc is used to assign configuration values to a fetcher
+type OptFunc func(f *Fetcher)
+
+// WithResolver registers the resolver of a scheme, replacing the built in one
+func WithResolver(scheme string, r Resolver) OptFunc {
+	return func(f *Fetcher) {
+		f.resolvers[scheme] = r
+	}
+}
+
+// WithCache stores fetched content in the cache
+func WithCache(c *Cache) OptFunc {
+	return func(f *Fetcher) {
+		f.cache = c
+	}
+}
+
+// WithLockfile pins references to the digests of the lockfile, references
+// that are not in it fail unless the lockfile is updated
+func WithLockfile(l *Lockfile) OptFunc {
+	return func(f *Fetcher) {
+		f.lock = l
+	}
+}
+
+// WithOffline only serves locked references from the cache, nothing is fetched
+func WithOffline(offline bool) OptFunc {
+	return func(f *Fetcher) {
+		f.offline = offline
+	}
+}
+
+// WithUpdateLock fetches every reference again and records its digest in the
+// lockfile, it is the only mode that writes the lockfile
+func WithUpdateLock(update bool) OptFunc {
+	return func(f *Fetcher) {
+		f.updateLock = update
+	}
+}
@@ -0,0 +1,131 @@
+// Package remote fetches the manifests a pipeline config references by URL,
+// git ref or OCI artifact instead of a path in the repository
+package remote
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HTTPS is the scheme of https:// references
+	HTTPS = "https"
+	// Git is the scheme of git::<repo>//<path>?ref=<ref> references
+	Git = "git"
+	// OCI is the scheme of oci://<registry>/<repository>:<tag>//<file> references
+	OCI = "oci"
+)
+
+var (
+	// ErrUnknownScheme is returned when no resolver is registered for the scheme of a reference
+	ErrUnknownScheme = errors.New("remote: no resolver for the reference")
+	// ErrNotCached is returned in offline mode for references that are not locked and cached
+	ErrNotCached = errors.New("remote: reference is not in the cache")
+	// ErrNotLocked is returned for references that are not pinned in the lockfile, unless the lockfile is updated
+	ErrNotLocked = errors.New("remote: reference is not pinned in the lockfile")
+	// ErrDigestMismatch is returned when the content of a reference does not match the digest of the lockfile
+	ErrDigestMismatch = errors.New("remote: content does not match the digest of the lockfile")
+)
+
+// Resolver fetches the content of the references of a scheme
+type Resolver interface {
+	Resolve(ref string) ([]byte, error)
+}
+
+// Scheme returns the scheme of a remote reference, or an empty string for paths
+func Scheme(ref string) string {
+	switch {
+	case strings.HasPrefix(ref, "https://"):
+		return HTTPS
+	case strings.HasPrefix(ref, "git::"):
+		return Git
+	case strings.HasPrefix(ref, "oci://"):
+		return OCI
+	default:
+		return ""
+	}
+}
+
+// IsRemote reports whether a file of a pipeline config is a remote reference
+func IsRemote(ref string) bool {
+	return Scheme(ref) != ""
+}
+
+// Fetcher fetches remote references through the resolver of their scheme.
+// Fetched content is stored in the cache by its digest. With a lockfile only
+// locked references are fetched, and only with the content of their digest,
+// unless the fetcher updates the lockfile.
+type Fetcher struct {
+	resolvers  map[string]Resolver
+	cache      *Cache
+	lock       *Lockfile
+	offline    bool
+	updateLock bool
+}
+
+// NewFetcher initializes a fetcher with the https, git and oci resolvers
+func NewFetcher(opts ...OptFunc) *Fetcher {
+	f := &Fetcher{
+		resolvers: map[string]Resolver{
+			HTTPS: &HTTPResolver{},
+			Git:   &GitResolver{},
+			OCI:   &OCIResolver{},
+		},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// Fetch returns the content of a remote reference
+func (f *Fetcher) Fetch(ref string) ([]byte, error) {
+	locked, isLocked := f.lock.Digest(ref)
+	if isLocked && f.cache != nil && !f.updateLock {
+		content, ok, err := f.cache.Get(locked)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return content, nil
+		}
+	}
+
+	if f.lock != nil && !isLocked && !f.updateLock {
+		return nil, errors.Wrap(ErrNotLocked, ref)
+	}
+
+	if f.offline {
+		return nil, errors.Wrap(ErrNotCached, ref)
+	}
+
+	resolver, ok := f.resolvers[Scheme(ref)]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownScheme, ref)
+	}
+
+	content, err := resolver.Resolve(ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not fetch %s", ref)
+	}
+
+	d := Digest(content)
+	if isLocked && d != locked && !f.updateLock {
+		return nil, errors.Wrapf(ErrDigestMismatch, "%s is %s, the lockfile has %s", ref, d, locked)
+	}
+
+	if f.cache != nil {
+		if err := f.cache.Put(content); err != nil {
+			return nil, err
+		}
+	}
+	if f.updateLock && d != locked {
+		if err := f.lock.Record(ref, d); err != nil {
+			return nil, err
+		}
+	}
+
+	return content, nil
+}
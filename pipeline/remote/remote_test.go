@@ -0,0 +1,147 @@
+package remote_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/namely/k8s-pipeliner/pipeline/remote"
+)
+
+const sidecar = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: envoy\n"
+
+// sidecarServer serves the sidecar manifest over https and counts the requests
+func sidecarServer(t *testing.T, requests *int) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.URL.Path != "/sidecars/envoy.yml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(sidecar))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestScheme(t *testing.T) {
+	assert.Equal(t, remote.HTTPS, remote.Scheme("https://example.com/envoy.yml"))
+	assert.Equal(t, remote.Git, remote.Scheme("git::https://github.com/namely/platform.git//envoy.yml?ref=v1.2"))
+	assert.Equal(t, remote.OCI, remote.Scheme("oci://ghcr.io/namely/sidecars:v1//envoy.yml"))
+	assert.False(t, remote.IsRemote("manifests/envoy.yml"))
+	assert.False(t, remote.IsRemote("http://example.com/envoy.yml"), "only https urls are fetched")
+}
+
+func TestFetcher(t *testing.T) {
+	var requests int
+	srv := sidecarServer(t, &requests)
+	ref := srv.URL + "/sidecars/envoy.yml"
+
+	dir := t.TempDir()
+	cache := remote.NewCache(filepath.Join(dir, "cache"))
+	lockPath := filepath.Join(dir, "pipeline.lock.yml")
+
+	fetcher := func(offline, update bool) *remote.Fetcher {
+		lock, err := remote.LoadLockfile(lockPath)
+		require.NoError(t, err)
+
+		return remote.NewFetcher(
+			remote.WithResolver(remote.HTTPS, &remote.HTTPResolver{Client: srv.Client()}),
+			remote.WithCache(cache),
+			remote.WithLockfile(lock),
+			remote.WithOffline(offline),
+			remote.WithUpdateLock(update),
+		)
+	}
+
+	t.Run("Unlocked references fail without writing the lockfile", func(t *testing.T) {
+		_, err := fetcher(false, false).Fetch(ref)
+		assert.Equal(t, remote.ErrNotLocked, errors.Cause(err))
+		assert.Equal(t, 0, requests)
+
+		_, err = os.Stat(lockPath)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("References are fetched, cached and locked when updating the lockfile", func(t *testing.T) {
+		content, err := fetcher(false, true).Fetch(ref)
+		require.NoError(t, err)
+		assert.Equal(t, sidecar, string(content))
+		assert.Equal(t, 1, requests)
+
+		lock, err := ioutil.ReadFile(lockPath)
+		require.NoError(t, err)
+		assert.Equal(t, "remotes:\n  "+ref+":\n    digest: "+remote.Digest([]byte(sidecar))+"\n", string(lock))
+
+		cached, ok, err := cache.Get(remote.Digest([]byte(sidecar)))
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, sidecar, string(cached))
+	})
+
+	t.Run("Locked references are read from the cache", func(t *testing.T) {
+		content, err := fetcher(false, false).Fetch(ref)
+		require.NoError(t, err)
+		assert.Equal(t, sidecar, string(content))
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("Offline fetchers only use the cache", func(t *testing.T) {
+		content, err := fetcher(true, false).Fetch(ref)
+		require.NoError(t, err)
+		assert.Equal(t, sidecar, string(content))
+
+		_, err = fetcher(true, true).Fetch(srv.URL + "/sidecars/other.yml")
+		assert.Equal(t, remote.ErrNotCached, errors.Cause(err))
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("Fetched content must match the lockfile", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(lockPath, []byte("remotes:\n  "+ref+":\n    digest: "+remote.Digest([]byte("changed"))+"\n"), 0644))
+
+		_, err := fetcher(false, false).Fetch(ref)
+		assert.Equal(t, remote.ErrDigestMismatch, errors.Cause(err))
+	})
+
+	t.Run("Updating the lockfile pins the current content", func(t *testing.T) {
+		_, err := fetcher(false, true).Fetch(ref)
+		require.NoError(t, err)
+
+		lock, err := ioutil.ReadFile(lockPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(lock), remote.Digest([]byte(sidecar)))
+	})
+
+	t.Run("Failed downloads are not locked", func(t *testing.T) {
+		require.NoError(t, os.Remove(lockPath))
+
+		_, err := fetcher(false, true).Fetch(srv.URL + "/sidecars/missing.yml")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "404 Not Found")
+
+		_, err = os.Stat(lockPath)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestCacheIgnoresCorruptedContent(t *testing.T) {
+	dir := t.TempDir()
+	cache := remote.NewCache(dir)
+	require.NoError(t, cache.Put([]byte(sidecar)))
+
+	digest := remote.Digest([]byte(sidecar))
+	file := filepath.Join(dir, "sha256", digest[len("sha256:"):])
+	require.NoError(t, ioutil.WriteFile(file, []byte("corrupted"), 0644))
+
+	_, ok, err := cache.Get(digest)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
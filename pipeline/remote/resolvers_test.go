@@ -0,0 +1,162 @@
+package remote_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/namely/k8s-pipeliner/pipeline/remote"
+)
+
+// gitRepo creates a repository with the sidecar tagged v1.2 and a later
+// commit on the default branch that changes it
+func gitRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@namely.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(content string) {
+		require.NoError(t, writeFile(filepath.Join(dir, "sidecars", "envoy.yml"), content))
+	}
+
+	run("init", "--quiet")
+	write(sidecar)
+	run("add", ".")
+	run("commit", "--quiet", "-m", "Add the envoy sidecar")
+	run("tag", "v1.2")
+	write("changed")
+	run("commit", "--quiet", "-am", "Change the envoy sidecar")
+
+	return dir
+}
+
+func TestGitResolver(t *testing.T) {
+	repo := gitRepo(t)
+	r := &remote.GitResolver{}
+
+	t.Run("Files are read at the ref", func(t *testing.T) {
+		content, err := r.Resolve("git::file://" + repo + "//sidecars/envoy.yml?ref=v1.2")
+		require.NoError(t, err)
+		assert.Equal(t, sidecar, string(content))
+	})
+
+	t.Run("The ref defaults to HEAD", func(t *testing.T) {
+		content, err := r.Resolve("git::" + repo + "//sidecars/envoy.yml")
+		require.NoError(t, err)
+		assert.Equal(t, "changed", string(content))
+	})
+
+	t.Run("Missing files fail", func(t *testing.T) {
+		_, err := r.Resolve("git::file://" + repo + "//sidecars/missing.yml?ref=v1.2")
+		assert.Error(t, err)
+	})
+
+	t.Run("References need a repository and a path", func(t *testing.T) {
+		for _, ref := range []string{"git::file://" + repo, "git::--upload-pack=touch//x", "git::" + repo + "//x?ref=--help"} {
+			_, err := r.Resolve(ref)
+			assert.Equal(t, remote.ErrInvalidGitRef, errors.Cause(err), ref)
+		}
+	})
+}
+
+// registry serves an artifact with the sidecar and a readme layer, tagged v1,
+// like a registry that needs an anonymous token
+func registry(t *testing.T) *httptest.Server {
+	blobs := map[string]string{
+		remote.Digest([]byte(sidecar)):  sidecar,
+		remote.Digest([]byte("readme")): "readme",
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"layers": []map[string]interface{}{
+			{"digest": remote.Digest([]byte(sidecar)), "annotations": map[string]string{"org.opencontainers.image.title": "envoy.yml"}},
+			{"digest": remote.Digest([]byte("readme")), "annotations": map[string]string{"org.opencontainers.image.title": "README.md"}},
+		},
+	})
+	require.NoError(t, err)
+
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "repository:platform/sidecars:pull", r.URL.Query().Get("scope"))
+			fmt.Fprint(w, `{"token": "anonymous"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer anonymous" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:platform/sidecars:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v2/platform/sidecars/manifests/v1":
+			w.Write(manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/platform/sidecars/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/platform/sidecars/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestOCIResolver(t *testing.T) {
+	srv := registry(t)
+	host := strings.TrimPrefix(srv.URL, "https://")
+	r := &remote.OCIResolver{Client: srv.Client()}
+
+	t.Run("Layers are selected by their title", func(t *testing.T) {
+		content, err := r.Resolve("oci://" + host + "/platform/sidecars:v1//envoy.yml")
+		require.NoError(t, err)
+		assert.Equal(t, sidecar, string(content))
+	})
+
+	t.Run("Artifacts with several layers need a file", func(t *testing.T) {
+		_, err := r.Resolve("oci://" + host + "/platform/sidecars:v1")
+		assert.Equal(t, remote.ErrNoOCILayer, errors.Cause(err))
+	})
+
+	t.Run("Unknown tags fail", func(t *testing.T) {
+		_, err := r.Resolve("oci://" + host + "/platform/sidecars:v2//envoy.yml")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "404 Not Found")
+	})
+
+	t.Run("References need a registry and a repository", func(t *testing.T) {
+		_, err := r.Resolve("oci://" + host)
+		assert.Equal(t, remote.ErrInvalidOCIRef, errors.Cause(err))
+	})
+}
+
+func writeFile(file, content string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, []byte(content), 0644)
+}
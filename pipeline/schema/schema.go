@@ -0,0 +1,130 @@
+// Package schema generates a JSON Schema for pipeline.yml files from the
+// config package structs so editors can offer completion and validation.
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+// Draft is the JSON Schema dialect of the generated schema
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document, it marshals to JSON with sorted keys
+type Schema map[string]interface{}
+
+// Generate returns the schema of a pipeline.yml for the given k8s-pipeliner version.
+// Fields tagged with jsonschema:"required" are required, and a stage must set
+// exactly one of its stage types.
+func Generate(version string) Schema {
+	g := &generator{defs: make(map[string]interface{})}
+	root := g.typeSchema(reflect.TypeOf(config.Pipeline{}))
+
+	return Schema{
+		"$schema":     Draft,
+		"$id":         "urn:k8s-pipeliner:pipeline:" + version,
+		"title":       "k8s-pipeliner pipeline",
+		"description": fmt.Sprintf("pipeline.yml configuration for k8s-pipeliner %s", version),
+		"$ref":        root["$ref"],
+		"$defs":       g.defs,
+	}
+}
+
+type generator struct {
+	defs map[string]interface{}
+}
+
+// typeSchema returns the schema of a single go type, structs are added to the
+// definitions and referenced so nested types are only described once
+func (g *generator) typeSchema(t reflect.Type) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			// register the name first so recursive types terminate
+			g.defs[t.Name()] = nil
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return Schema{"$ref": "#/$defs/" + t.Name()}
+	}
+
+	// interfaces and anything else accept any value
+	return Schema{}
+}
+
+func (g *generator) structSchema(t reflect.Type) Schema {
+	properties := make(map[string]interface{})
+	required := []string{}
+	var variants []interface{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		key := yamlKey(f)
+		if key == "-" {
+			continue
+		}
+
+		properties[key] = g.typeSchema(f.Type)
+		if f.Tag.Get("jsonschema") == "required" {
+			required = append(required, key)
+		}
+
+		if t == stageType && isStageVariant(f) {
+			variants = append(variants, Schema{"required": []string{key}})
+		}
+	}
+
+	s := Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	if len(variants) > 0 {
+		s["oneOf"] = variants
+	}
+
+	return s
+}
+
+var stageType = reflect.TypeOf(config.Stage{})
+
+// isStageVariant reports whether a config.Stage field is one of the stage
+// types, those are the struct pointers of which only one may be set
+func isStageVariant(f reflect.StructField) bool {
+	return f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct
+}
+
+func yamlKey(f reflect.StructField) string {
+	key := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if key == "" {
+		return strings.ToLower(f.Name)
+	}
+
+	return key
+}
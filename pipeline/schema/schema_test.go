@@ -0,0 +1,123 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+
+	"github.com/namely/k8s-pipeliner/pipeline/schema"
+)
+
+func TestGenerate(t *testing.T) {
+	s := schema.Generate("v1.2.3")
+
+	assert.Equal(t, schema.Draft, s["$schema"])
+	assert.Equal(t, "urn:k8s-pipeliner:pipeline:v1.2.3", s["$id"])
+	assert.Equal(t, "#/$defs/Pipeline", s["$ref"])
+
+	defs := s["$defs"].(map[string]interface{})
+
+	t.Run("Fields tagged as required are required", func(t *testing.T) {
+		pipeline := defs["Pipeline"].(schema.Schema)
+		assert.Equal(t, []string{"name", "application", "stages"}, pipeline["required"])
+		assert.Equal(t, false, pipeline["additionalProperties"])
+
+		_, ok := defs["Moniker"].(schema.Schema)["required"]
+		assert.False(t, ok, "moniker has no required fields")
+	})
+
+	t.Run("Stages set exactly one stage type", func(t *testing.T) {
+		stage := defs["Stage"].(schema.Schema)
+		assert.Contains(t, stage["oneOf"], schema.Schema{"required": []string{"deployEmbeddedManifests"}})
+		assert.Contains(t, stage["oneOf"], schema.Schema{"required": []string{"spinnaker"}})
+		assert.NotContains(t, stage["oneOf"], schema.Schema{"required": []string{"notifications"}})
+	})
+}
+
+func TestGenerateValidatesPipelines(t *testing.T) {
+	validator := compile(t)
+
+	fixtures, err := filepath.Glob(filepath.Join("..", "builder", "testdata", "golden", "*.yml"))
+	require.NoError(t, err)
+	fixtures = append(fixtures, filepath.Join("..", "config", "testdata", "pipeline.full.yml"))
+
+	for _, fixture := range fixtures {
+		content, err := ioutil.ReadFile(fixture)
+		require.NoError(t, err)
+
+		assert.NoError(t, validate(t, validator, content), fixture)
+	}
+
+	invalid := map[string]string{
+		"missing name": `
+application: nginx
+stages: []
+`,
+		"unknown field": `
+name: nginx
+application: nginx
+stages: []
+colour: blue
+`,
+		"two stage types": `
+name: nginx
+application: nginx
+stages:
+  - name: Deploy
+    manualJudgement: {}
+    variables: {}
+`,
+		"no stage type": `
+name: nginx
+application: nginx
+stages:
+  - name: Deploy
+`,
+		"wrong type": `
+name: nginx
+application: nginx
+stages:
+  - name: Scale
+    scaleManifest:
+      kind: deployment
+      name: nginx
+      namespace: web
+      replicas: two
+`,
+	}
+
+	for name, content := range invalid {
+		assert.Error(t, validate(t, validator, []byte(content)), name)
+	}
+}
+
+func compile(t *testing.T) *jsonschema.Schema {
+	out, err := json.Marshal(schema.Generate("test"))
+	require.NoError(t, err)
+
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft2020
+	require.NoError(t, c.AddResource("pipeline.schema.json", bytes.NewReader(out)))
+
+	s, err := c.Compile("pipeline.schema.json")
+	require.NoError(t, err)
+
+	return s
+}
+
+func validate(t *testing.T, s *jsonschema.Schema, content []byte) error {
+	out, err := yaml.YAMLToJSON(content)
+	require.NoError(t, err)
+
+	var doc interface{}
+	require.NoError(t, json.Unmarshal(out, &doc))
+
+	return s.Validate(doc)
+}
@@ -0,0 +1,134 @@
+package validation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cronField describes one field of a quartz cron expression
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{name: "seconds", min: 0, max: 59},
+	{name: "minutes", min: 0, max: 59},
+	{name: "hours", min: 0, max: 23},
+	{name: "day-of-month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "day-of-week", min: 1, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+	{name: "year", min: 1970, max: 2099},
+}
+
+const (
+	dayOfMonth = 3
+	dayOfWeek  = 5
+)
+
+// parseCron checks that expr is a quartz cron expression as used by spinnaker,
+// which has a seconds field and an optional year compared to unix cron
+func parseCron(expr string) error {
+	fields := strings.Fields(expr)
+	if len(fields) != 6 && len(fields) != 7 {
+		return fmt.Errorf("cron expression %q has %d fields, expected 6 or 7 (seconds minutes hours day-of-month month day-of-week [year])", expr, len(fields))
+	}
+
+	for i, f := range fields {
+		for _, part := range strings.Split(f, ",") {
+			if err := cronFields[i].check(i, part); err != nil {
+				return fmt.Errorf("cron expression %q has an invalid %s field: %s", expr, cronFields[i].name, err)
+			}
+		}
+	}
+
+	// quartz requires exactly one of the day fields to be unspecified
+	if (fields[dayOfMonth] == "?") == (fields[dayOfWeek] == "?") {
+		return fmt.Errorf("cron expression %q must set ? in exactly one of the day-of-month and day-of-week fields", expr)
+	}
+
+	return nil
+}
+
+func (f cronField) check(index int, part string) error {
+	switch {
+	case part == "*":
+		return nil
+	case part == "?":
+		if index == dayOfMonth || index == dayOfWeek {
+			return nil
+		}
+		return fmt.Errorf("? is only allowed for the day fields")
+	case index == dayOfMonth && (part == "L" || part == "LW"):
+		return nil
+	case index == dayOfMonth && strings.HasPrefix(part, "L-"):
+		_, err := f.value(part[2:])
+		return err
+	case index == dayOfMonth && strings.HasSuffix(part, "W"):
+		_, err := f.value(strings.TrimSuffix(part, "W"))
+		return err
+	case index == dayOfWeek && part == "L":
+		return nil
+	case index == dayOfWeek && strings.HasSuffix(part, "L"):
+		_, err := f.value(strings.TrimSuffix(part, "L"))
+		return err
+	case index == dayOfWeek && strings.Contains(part, "#"):
+		day, nth := split2(part, "#")
+		if _, err := f.value(day); err != nil {
+			return err
+		}
+		if n, err := strconv.Atoi(nth); err != nil || n < 1 || n > 5 {
+			return fmt.Errorf("%s must be followed by a week between 1 and 5", part)
+		}
+		return nil
+	}
+
+	base, step := split2(part, "/")
+	if strings.Contains(part, "/") {
+		if n, err := strconv.Atoi(step); err != nil || n < 1 {
+			return fmt.Errorf("%s has an invalid increment", part)
+		}
+		if base == "*" {
+			return nil
+		}
+	}
+
+	from, to := split2(base, "-")
+	if _, err := f.value(from); err != nil {
+		return err
+	}
+	if strings.Contains(base, "-") {
+		if _, err := f.value(to); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// value parses a number or a name of the field
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("%q is not a value between %d and %d", s, f.min, f.max)
+	}
+
+	return n, nil
+}
+
+func split2(s, sep string) (string, string) {
+	parts := strings.SplitN(s, sep, 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
@@ -0,0 +1,391 @@
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
+)
+
+// dagRules check the refId / reliesOn graph of the built pipeline, so they
+// validate what spinnaker receives no matter if the refs were declared or
+// assigned by the builder
+func dagRules() []Rule {
+	return []Rule{
+		{Name: "dag-duplicate-refid", Description: "every stage has a unique refId", Severity: SeverityError, Check: dagDuplicateRefIDs},
+		{Name: "dag-unknown-dependency", Description: "reliesOn only references refIds of stages in the pipeline", Severity: SeverityError, Check: dagUnknownDependencies},
+		{Name: "dag-cycle", Description: "stages do not depend on each other in a cycle", Severity: SeverityError, Check: dagCycles},
+		{Name: "dag-unreachable", Description: "every stage can run, none depend on a stage in a cycle or a missing refId", Severity: SeverityError, Check: dagUnreachable},
+		{Name: "dag-mixed-refs", Description: "either every stage declares a refId or the pipeline is built with --linear or --hybrid", Severity: SeverityError, Check: dagMixedRefs},
+		{Name: "dag-disconnected", Description: "stages without dependencies have stages depending on them", Severity: SeverityWarn, Check: dagDisconnected},
+		{Name: "dag-baked-manifest", Description: "stages deploying a baked manifest depend on the stage that bakes it", Severity: SeverityError, Check: dagBakedManifests},
+		{Name: "dag-linear-overwrite", Description: "--linear does not replace refIds or reliesOn declared in the pipeline", Severity: SeverityWarn, Check: dagLinearOverwrite},
+	}
+}
+
+// graph indexes the stages of a target by refId
+type graph struct {
+	stages []Stage
+	byRef  map[string]int
+}
+
+func newGraph(t *Target) *graph {
+	g := &graph{stages: t.Stages, byRef: make(map[string]int)}
+	for i, s := range t.Stages {
+		if _, ok := g.byRef[s.RefID]; !ok && s.RefID != "" {
+			g.byRef[s.RefID] = i
+		}
+	}
+
+	return g
+}
+
+// dependencies returns the indexes of the stages a stage relies on, unknown
+// refIds are skipped
+func (g *graph) dependencies(i int) []int {
+	var deps []int
+	for _, ref := range requisites(g.stages[i]) {
+		if j, ok := g.byRef[ref]; ok {
+			deps = append(deps, j)
+		}
+	}
+
+	return deps
+}
+
+// dependsOn reports if stage i transitively relies on stage j
+func (g *graph) dependsOn(i, j int, seen map[int]bool) bool {
+	for _, k := range g.dependencies(i) {
+		if k == j {
+			return true
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if g.dependsOn(k, j, seen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cycles returns every cycle in the graph as a list of stage indexes, each
+// cycle is reported once starting at its first stage
+func (g *graph) cycles() [][]int {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	state := make([]int, len(g.stages))
+	seen := make(map[string]bool)
+
+	var cycles [][]int
+	var stack []int
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		stack = append(stack, i)
+
+		for _, j := range g.dependencies(i) {
+			switch state[j] {
+			case unvisited:
+				visit(j)
+			case visiting:
+				var cycle []int
+				for k := len(stack) - 1; k >= 0; k-- {
+					cycle = append([]int{stack[k]}, cycle...)
+					if stack[k] == j {
+						break
+					}
+				}
+				if key := cycleKey(cycle); !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, rotate(cycle))
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[i] = done
+	}
+
+	for i := range g.stages {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+
+	return cycles
+}
+
+func dagDuplicateRefIDs(t *Target) []Finding {
+	var findings []Finding
+	first := make(map[string]int)
+	for i, s := range t.Stages {
+		if s.RefID == "" {
+			continue
+		}
+
+		if j, ok := first[s.RefID]; ok {
+			findings = append(findings, Finding{
+				Stage:   &t.Stages[i],
+				Message: fmt.Sprintf("refId %s is already used by stage %q", s.RefID, t.Stages[j].Name),
+			})
+			continue
+		}
+		first[s.RefID] = i
+	}
+
+	return findings
+}
+
+func dagUnknownDependencies(t *Target) []Finding {
+	g := newGraph(t)
+
+	var findings []Finding
+	for i, s := range t.Stages {
+		for _, ref := range requisites(s) {
+			if _, ok := g.byRef[ref]; !ok {
+				findings = append(findings, Finding{
+					Stage:   &t.Stages[i],
+					Message: fmt.Sprintf("reliesOn references refId %s which no stage declares", ref),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+func dagCycles(t *Target) []Finding {
+	g := newGraph(t)
+
+	var findings []Finding
+	for _, cycle := range g.cycles() {
+		names := make([]string, 0, len(cycle)+1)
+		for _, i := range cycle {
+			names = append(names, fmt.Sprintf("%q", t.Stages[i].Name))
+		}
+		names = append(names, names[0])
+
+		findings = append(findings, Finding{
+			Stage:   &t.Stages[cycle[0]],
+			Message: "stages depend on each other in a cycle: " + strings.Join(names, " -> "),
+		})
+	}
+
+	return findings
+}
+
+func dagUnreachable(t *Target) []Finding {
+	g := newGraph(t)
+
+	// blocked stages can never start, either because they are part of a cycle
+	// or because they wait for a stage that does not exist
+	blocked := make(map[int]string)
+	for _, cycle := range g.cycles() {
+		for _, i := range cycle {
+			blocked[i] = "is part of a cycle"
+		}
+	}
+	for i, s := range t.Stages {
+		for _, ref := range requisites(s) {
+			if _, ok := g.byRef[ref]; !ok {
+				blocked[i] = "relies on the unknown refId " + ref
+			}
+		}
+	}
+
+	var findings []Finding
+	for i := range t.Stages {
+		if _, ok := blocked[i]; ok {
+			continue
+		}
+
+		if j, ok := blockedDependency(g, i, blocked, make(map[int]bool)); ok {
+			findings = append(findings, Finding{
+				Stage:   &t.Stages[i],
+				Message: fmt.Sprintf("stage can never run, it depends on stage %q which %s", t.Stages[j].Name, blocked[j]),
+			})
+		}
+	}
+
+	return findings
+}
+
+// blockedDependency returns the first blocked stage that stage i transitively depends on
+func blockedDependency(g *graph, i int, blocked map[int]string, visited map[int]bool) (int, bool) {
+	visited[i] = true
+	for _, j := range g.dependencies(i) {
+		if _, ok := blocked[j]; ok {
+			return j, true
+		}
+		if visited[j] {
+			continue
+		}
+		if k, ok := blockedDependency(g, j, blocked, visited); ok {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
+
+func dagMixedRefs(t *Target) []Finding {
+	var withRef []string
+	for _, s := range t.Stages {
+		if s.RefID != "" {
+			withRef = append(withRef, fmt.Sprintf("%q", s.Name))
+		}
+	}
+
+	if len(withRef) == 0 {
+		return nil
+	}
+
+	var findings []Finding
+	for i, s := range t.Stages {
+		if s.RefID == "" {
+			findings = append(findings, Finding{
+				Stage:   &t.Stages[i],
+				Message: fmt.Sprintf("stage has no refId while %s declare one, set a refId on every stage or build the pipeline with --linear or --hybrid", strings.Join(withRef, ", ")),
+			})
+		}
+	}
+
+	return findings
+}
+
+func dagDisconnected(t *Target) []Finding {
+	if len(t.Stages) < 2 {
+		return nil
+	}
+
+	g := newGraph(t)
+	dependents := make(map[int]bool)
+	for i := range t.Stages {
+		for _, j := range g.dependencies(i) {
+			dependents[j] = true
+		}
+	}
+
+	var findings []Finding
+	for i, s := range t.Stages {
+		if s.RefID == "" || len(requisites(s)) > 0 || dependents[i] {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Stage:   &t.Stages[i],
+			Message: "stage has no dependencies and no stage relies on it, it runs in parallel to the start of the pipeline",
+		})
+	}
+
+	return findings
+}
+
+func dagBakedManifests(t *Target) []Finding {
+	bakes := make(map[string]int)
+	for i, s := range t.Stages {
+		bs, ok := s.Built.(*types.BakeManifestStage)
+		if !ok {
+			continue
+		}
+		for _, ea := range bs.ExpectedArtifacts {
+			bakes[ea.ID] = i
+		}
+	}
+
+	g := newGraph(t)
+	var findings []Finding
+	for i, s := range t.Stages {
+		ms, ok := s.Built.(*types.ManifestStage)
+		if !ok {
+			continue
+		}
+
+		j, ok := bakes[ms.ManifestArtifactID]
+		if !ok || g.dependsOn(i, j, make(map[int]bool)) {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Stage:   &t.Stages[i],
+			Message: fmt.Sprintf("stage deploys the manifest %s but does not depend on stage %q which bakes it", ms.ManifestArtifactID, t.Stages[j].Name),
+		})
+	}
+
+	return findings
+}
+
+func dagLinearOverwrite(t *Target) []Finding {
+	if !t.Linear {
+		return nil
+	}
+
+	var findings []Finding
+	for i, s := range t.Stages {
+		declared := s.Config
+		if declared.RefID != "" && declared.RefID != s.RefID {
+			findings = append(findings, Finding{
+				Stage:   &t.Stages[i],
+				Message: fmt.Sprintf("--linear replaces the declared refId %s with %s", declared.RefID, s.RefID),
+			})
+		}
+
+		if len(declared.ReliesOn) > 0 && !equalRefs(declared.ReliesOn, requisites(s)) {
+			findings = append(findings, Finding{
+				Stage:   &t.Stages[i],
+				Message: fmt.Sprintf("--linear replaces the declared reliesOn [%s] with [%s]", strings.Join(declared.ReliesOn, ", "), strings.Join(requisites(s), ", ")),
+			})
+		}
+	}
+
+	return findings
+}
+
+// requisites returns the refIds a built stage relies on
+func requisites(s Stage) []string {
+	return stageMetadata(s.Built).RequisiteStageRefIds
+}
+
+func equalRefs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func cycleKey(cycle []int) string {
+	sorted := append([]int{}, cycle...)
+	sort.Ints(sorted)
+
+	return fmt.Sprint(sorted)
+}
+
+// rotate starts a cycle at its lowest stage index so it reads in pipeline order
+func rotate(cycle []int) []int {
+	min := 0
+	for i := range cycle {
+		if cycle[i] < cycle[min] {
+			min = i
+		}
+	}
+
+	return append(append([]int{}, cycle[min:]...), cycle[:min]...)
+}
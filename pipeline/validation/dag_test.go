@@ -0,0 +1,184 @@
+package validation_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/namely/k8s-pipeliner/pipeline/validation"
+)
+
+// judgement returns a stage that can be built without any manifest files
+func judgement(name, refID string, reliesOn ...string) config.Stage {
+	return config.Stage{
+		Name:            name,
+		RefID:           refID,
+		ReliesOn:        reliesOn,
+		ManualJudgement: &config.ManualJudgementStage{},
+	}
+}
+
+func dagResults(t *testing.T, stages []config.Stage, opts ...builder.OptFunc) []string {
+	p := &config.Pipeline{Name: "Deploy", Application: "web", Stages: stages}
+
+	results, err := validation.New(validation.WithBuilderOptions(opts...)).Validate(p)
+	require.NoError(t, err)
+
+	var out []string
+	for _, r := range results {
+		out = append(out, r.String())
+	}
+
+	return out
+}
+
+func TestValidateDAG(t *testing.T) {
+	t.Run("Valid fan out and fan in", func(t *testing.T) {
+		results := dagResults(t, []config.Stage{
+			judgement("Build", "build"),
+			judgement("Deploy int", "int", "build"),
+			judgement("Deploy staging", "staging", "build"),
+			judgement("Promote", "promote", "int", "staging"),
+		})
+
+		assert.Empty(t, results)
+	})
+
+	t.Run("Duplicate refIds", func(t *testing.T) {
+		results := dagResults(t, []config.Stage{
+			judgement("Build", "build"),
+			judgement("Deploy", "build", "build"),
+		})
+
+		assert.Contains(t, results, `error: stage "Deploy" (refId build): [dag-duplicate-refid] refId build is already used by stage "Build"`)
+	})
+
+	t.Run("Unknown dependencies and the stages after them", func(t *testing.T) {
+		results := dagResults(t, []config.Stage{
+			judgement("Build", "build"),
+			judgement("Deploy", "deploy", "bulid"),
+			judgement("Promote", "promote", "deploy"),
+		})
+
+		assert.Equal(t, []string{
+			`error: stage "Deploy" (refId deploy): [dag-unknown-dependency] reliesOn references refId bulid which no stage declares`,
+			`error: stage "Promote" (refId promote): [dag-unreachable] stage can never run, it depends on stage "Deploy" which relies on the unknown refId bulid`,
+			`warn: stage "Build" (refId build): [dag-disconnected] stage has no dependencies and no stage relies on it, it runs in parallel to the start of the pipeline`,
+		}, results)
+	})
+
+	t.Run("Cycles", func(t *testing.T) {
+		results := dagResults(t, []config.Stage{
+			judgement("Build", "build"),
+			judgement("Deploy", "deploy", "build", "verify"),
+			judgement("Verify", "verify", "deploy"),
+			judgement("Promote", "promote", "verify"),
+		})
+
+		assert.Equal(t, []string{
+			`error: stage "Deploy" (refId deploy): [dag-cycle] stages depend on each other in a cycle: "Deploy" -> "Verify" -> "Deploy"`,
+			`error: stage "Promote" (refId promote): [dag-unreachable] stage can never run, it depends on stage "Verify" which is part of a cycle`,
+		}, results)
+	})
+
+	t.Run("Mixed linear and explicit refs", func(t *testing.T) {
+		results := dagResults(t, []config.Stage{
+			judgement("Build", "build"),
+			judgement("Deploy", "", "build"),
+		})
+
+		assert.Contains(t, results, `error: stage "Deploy" (refId ): [dag-mixed-refs] stage has no refId while "Build" declare one, set a refId on every stage or build the pipeline with --linear or --hybrid`)
+	})
+
+	t.Run("Disconnected stages", func(t *testing.T) {
+		results := dagResults(t, []config.Stage{
+			judgement("Build", "build"),
+			judgement("Deploy", "deploy", "build"),
+			judgement("Notify", "notify"),
+		})
+
+		assert.Equal(t, []string{
+			`warn: stage "Notify" (refId notify): [dag-disconnected] stage has no dependencies and no stage relies on it, it runs in parallel to the start of the pipeline`,
+		}, results)
+	})
+
+	t.Run("Linear builds overwriting declared refs", func(t *testing.T) {
+		results := dagResults(t, []config.Stage{
+			judgement("Build", "build"),
+			judgement("Deploy", "", "build"),
+			judgement("Verify", ""),
+		}, builder.WithLinear(true))
+
+		assert.Equal(t, []string{
+			`warn: stage "Build" (refId 0): [dag-linear-overwrite] --linear replaces the declared refId build with 0`,
+			`warn: stage "Deploy" (refId 1): [dag-linear-overwrite] --linear replaces the declared reliesOn [build] with [0]`,
+		}, results)
+	})
+}
+
+func TestValidateDAGHybrid(t *testing.T) {
+	results := dagResults(t, []config.Stage{
+		judgement("Build", "build"),
+		judgement("Deploy int", "deploy-int"),
+		judgement("Deploy staging", "deploy-staging", "build"),
+		judgement("Promote", "", "deploy-int", "deploy-staging"),
+	}, builder.WithHybrid(true))
+
+	assert.Empty(t, results, "hybrid refs are resolved without warnings")
+}
+
+func TestValidateDAGBakedManifests(t *testing.T) {
+	bake := config.Stage{
+		Name:  "Bake",
+		RefID: "bake",
+		BakeManifest: &config.BakeManifestStage{
+			TemplateRenderer: "HELM3",
+			OutputName:       "web",
+			InputArtifacts:   []config.InputArtifact{{ID: "web-chart"}},
+		},
+	}
+	deploy := func(reliesOn ...string) config.Stage {
+		return config.Stage{
+			Name:     "Deploy",
+			RefID:    "deploy",
+			ReliesOn: reliesOn,
+			Account:  "int-k8s",
+			DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+				ManifestArtifactID: "web",
+			},
+		}
+	}
+	results := func(stages ...config.Stage) []string {
+		p := &config.Pipeline{
+			Name:        "Deploy",
+			Application: "web",
+			ExpectedArtifacts: []config.ExpectedArtifact{{
+				ID:    "web-chart",
+				Match: config.Artifact{Type: "helm/chart", Account: "charts", Name: "web"},
+			}},
+			Stages: stages,
+		}
+
+		results, err := validation.New().Validate(p)
+		require.NoError(t, err)
+
+		var out []string
+		for _, r := range results {
+			out = append(out, r.String())
+		}
+
+		return out
+	}
+
+	t.Run("Deploys that depend on the bake", func(t *testing.T) {
+		assert.Empty(t, results(bake, judgement("Approve", "approve", "bake"), deploy("approve")))
+	})
+
+	t.Run("Deploys that run before or in parallel to the bake", func(t *testing.T) {
+		assert.Contains(t, results(bake, deploy()),
+			`error: stage "Deploy" (refId deploy): [dag-baked-manifest] stage deploys the manifest web but does not depend on stage "Bake" which bakes it`)
+	})
+}
@@ -0,0 +1,32 @@
+package validation
+
+import (
+	"github.com/namely/k8s-pipeliner/pipeline/builder"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+// OptFunc is used to configure a validator
+type OptFunc func(v *Validator)
+
+// WithRules registers additional rules next to the built in ones
+func WithRules(rules ...Rule) OptFunc {
+	return func(v *Validator) {
+		v.rules = append(v.rules, rules...)
+	}
+}
+
+// WithProject applies the rule settings of a project config, allowing rules to
+// be disabled or to change their severity
+func WithProject(p *config.Project) OptFunc {
+	return func(v *Validator) {
+		v.ruleConfig = p.Validation.Rules
+	}
+}
+
+// WithBuilderOptions sets the options the pipeline is built with before the
+// rules are run, so the validated pipeline matches the one that is deployed
+func WithBuilderOptions(opts ...builder.OptFunc) OptFunc {
+	return func(v *Validator) {
+		v.builderOptions = opts
+	}
+}
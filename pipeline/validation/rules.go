@@ -0,0 +1,270 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder"
+	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultRules returns the rules the validator runs unless they are disabled
+// in the project config
+func DefaultRules() []Rule {
+	rules := append(dagRules(), triggerRules()...)
+	return append(rules, []Rule{
+		StageRule("deploy-resources", "deploy containers set cpu and memory requests and limits", SeverityError, deployResources),
+		StageRule("deploy-readiness-probe", "deploy containers define a readiness probe", SeverityWarn, deployReadinessProbe),
+		StageRule("runjob-resources", "run job containers set cpu and memory requests and limits", SeverityWarn, runJobResources),
+		StageRule("runjob-delete-job", "run job stages do not set the unsupported deleteJob option", SeverityWarn, runJobDeleteJob),
+		StageRule("runjob-service-account", "run job stages set a service account", SeverityInfo, runJobServiceAccount),
+		workloadRule("manifest-resources", "embedded manifest containers set cpu and memory requests and limits", SeverityError, manifestResources),
+		workloadRule("manifest-readiness-probe", "embedded deployments, statefulsets, daemonsets, replicasets and rollouts define readiness probes", SeverityWarn, manifestReadinessProbe),
+		{Name: "manifest-image-tag", Description: "embedded manifest images are pinned to a tag other than latest or bound to a required artifact", Severity: SeverityWarn, Check: manifestImageTags},
+		StageRule("manifest-namespace", "namespaced embedded manifests set a namespace", SeverityWarn, manifestNamespace),
+	}...)
+}
+
+func deployResources(s Stage) []string {
+	ds, ok := s.Built.(*types.DeployStage)
+	if !ok {
+		return nil
+	}
+
+	var msgs []string
+	for _, cluster := range ds.Clusters {
+		for _, c := range cluster.Containers {
+			msgs = append(msgs, containerResources(c)...)
+		}
+	}
+
+	return msgs
+}
+
+func deployReadinessProbe(s Stage) []string {
+	ds, ok := s.Built.(*types.DeployStage)
+	if !ok {
+		return nil
+	}
+
+	var msgs []string
+	for _, cluster := range ds.Clusters {
+		for _, c := range cluster.Containers {
+			if c.ReadinessProbe == nil {
+				msgs = append(msgs, fmt.Sprintf("container %s has no readiness probe", c.Name))
+			}
+		}
+	}
+
+	return msgs
+}
+
+func runJobResources(s Stage) []string {
+	rj, ok := s.Built.(*types.RunJobStage)
+	if !ok || rj.Container == nil {
+		return nil
+	}
+
+	return containerResources(rj.Container)
+}
+
+func runJobDeleteJob(s Stage) []string {
+	if s.Config.RunJob == nil || !s.Config.RunJob.DeleteJob {
+		return nil
+	}
+
+	return []string{"deleteJob is not supported by the run job stage and has no effect"}
+}
+
+func runJobServiceAccount(s Stage) []string {
+	if s.Config.RunJob == nil || s.Config.RunJob.ServiceAccountName != "" {
+		return nil
+	}
+
+	return []string{"no serviceAccountName is set, the job runs as the default service account of its namespace"}
+}
+
+// containerResources reports the requests and limits that are not set on a
+// container, the builder renders those as a zero quantity
+func containerResources(c *types.Container) []string {
+	var msgs []string
+	for _, r := range []struct {
+		kind, value string
+	}{
+		{"cpu requests", c.Requests.CPU},
+		{"memory requests", c.Requests.Memory},
+		{"cpu limits", c.Limits.CPU},
+		{"memory limits", c.Limits.Memory},
+	} {
+		if r.value == "" || r.value == "0" {
+			msgs = append(msgs, fmt.Sprintf("container %s is missing %s", c.Name, r.kind))
+		}
+	}
+
+	return msgs
+}
+
+// workloadRule returns a stage rule for checks that inspect the containers of embedded manifests
+func workloadRule(name, description string, severity Severity, check func(w builder.Workloads, s Stage) []string) Rule {
+	return Rule{
+		Name:        name,
+		Description: description,
+		Severity:    severity,
+		Check: func(t *Target) []Finding {
+			return StageRule(name, description, severity, func(s Stage) []string {
+				return check(t.Workloads, s)
+			}).Check(t)
+		},
+	}
+}
+
+func manifestResources(w builder.Workloads, s Stage) []string {
+	var msgs []string
+	for _, u := range embeddedManifests(s) {
+		for _, c := range w.Containers(u) {
+			for _, r := range []string{"requests", "limits"} {
+				for _, res := range []string{"cpu", "memory"} {
+					if _, ok, _ := unstructured.NestedFieldNoCopy(c, "resources", r, res); !ok {
+						msgs = append(msgs, fmt.Sprintf("%s container %s is missing %s %s", manifestName(u), c["name"], res, r))
+					}
+				}
+			}
+		}
+	}
+
+	return msgs
+}
+
+// servingKinds are the workloads that keep their pods running and serve traffic
+var servingKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+	"ReplicaSet":  true,
+	"Rollout":     true,
+}
+
+func manifestReadinessProbe(w builder.Workloads, s Stage) []string {
+	var msgs []string
+	for _, u := range embeddedManifests(s) {
+		if !servingKinds[u.GetKind()] {
+			continue
+		}
+
+		for _, c := range w.Containers(u) {
+			if _, ok := c["readinessProbe"]; !ok {
+				msgs = append(msgs, fmt.Sprintf("%s container %s has no readiness probe", manifestName(u), c["name"]))
+			}
+		}
+	}
+
+	return msgs
+}
+
+func manifestImageTags(t *Target) []Finding {
+	var findings []Finding
+	for i, s := range t.Stages {
+		for _, msg := range manifestImageTag(t.Workloads, s, boundImages(t.Config, s.Config)) {
+			findings = append(findings, Finding{Stage: &t.Stages[i], Message: msg})
+		}
+	}
+
+	return findings
+}
+
+func manifestImageTag(w builder.Workloads, s Stage, bound map[string]bool) []string {
+	var msgs []string
+	for _, u := range embeddedManifests(s) {
+		for _, c := range w.Containers(u) {
+			image, _ := c["image"].(string)
+			if image == "" || strings.Contains(image, "@") || strings.Contains(image, "${") {
+				continue
+			}
+
+			// the tag follows the last colon, unless that colon belongs to a registry port
+			name, tag := image, ""
+			if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+				name, tag = image[:i], image[i+1:]
+			}
+
+			// spinnaker replaces the images of required docker artifacts
+			if bound[name] {
+				continue
+			}
+
+			if tag == "" || tag == "latest" {
+				msgs = append(msgs, fmt.Sprintf("%s container %s uses image %s without a pinned tag", manifestName(u), c["name"], image))
+			}
+		}
+	}
+
+	return msgs
+}
+
+// boundImages returns the image names of the docker artifacts a manifest stage requires
+func boundImages(p *config.Pipeline, s config.Stage) map[string]bool {
+	if s.DeployEmbeddedManifests == nil {
+		return nil
+	}
+
+	bound := make(map[string]bool)
+	for _, id := range s.DeployEmbeddedManifests.RequiredArtifactIDs {
+		for _, ea := range p.ExpectedArtifacts {
+			if ea.ID == id && ea.Match.Type == builder.DockerImageArtifact {
+				bound[ea.Match.Name] = true
+			}
+		}
+	}
+
+	return bound
+}
+
+// clusterScopedKinds are the built in kinds that can't have a namespace
+var clusterScopedKinds = map[string]bool{
+	"Namespace":                      true,
+	"Node":                           true,
+	"PersistentVolume":               true,
+	"StorageClass":                   true,
+	"PriorityClass":                  true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CustomResourceDefinition":       true,
+	"PodSecurityPolicy":              true,
+	"MutatingWebhookConfiguration":   true,
+	"ValidatingWebhookConfiguration": true,
+	"APIService":                     true,
+}
+
+func manifestNamespace(s Stage) []string {
+	var msgs []string
+	for _, u := range embeddedManifests(s) {
+		if u.GetNamespace() == "" && !clusterScopedKinds[u.GetKind()] {
+			msgs = append(msgs, fmt.Sprintf("%s has no namespace and is deployed to the default namespace of account %s", manifestName(u), s.Config.Account))
+		}
+	}
+
+	return msgs
+}
+
+// embeddedManifests returns the manifests of a deployEmbeddedManifests stage
+func embeddedManifests(s Stage) []*unstructured.Unstructured {
+	ms, ok := s.Built.(*types.ManifestStage)
+	if !ok || s.Config.DeployEmbeddedManifests == nil {
+		return nil
+	}
+
+	var manifests []*unstructured.Unstructured
+	for _, obj := range ms.Manifests {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			manifests = append(manifests, u)
+		}
+	}
+
+	return manifests
+}
+
+func manifestName(u *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s %s", u.GetKind(), u.GetName())
+}
@@ -0,0 +1,141 @@
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	// cron trigger time zones are checked without relying on the zoneinfo of the host
+	_ "time/tzdata"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+// triggerRules check the triggers of the pipeline config
+func triggerRules() []Rule {
+	return []Rule{
+		{Name: "trigger-git", Description: "git triggers name a supported source, a project and a slug", Severity: SeverityError, Check: triggerCheck(triggerGit)},
+		{Name: "trigger-cron", Description: "cron triggers use a quartz cron expression and a known time zone", Severity: SeverityError, Check: triggerCheck(triggerCron)},
+		{Name: "trigger-pipeline", Description: "pipeline triggers name the upstream application, pipeline and known statuses", Severity: SeverityError, Check: triggerCheck(triggerPipeline)},
+		{Name: "trigger-pubsub", Description: "pubsub triggers name a supported system and a subscription", Severity: SeverityError, Check: triggerCheck(triggerPubSub)},
+	}
+}
+
+var (
+	gitSources       = []string{"github", "gitlab", "bitbucket", "stash"}
+	pipelineStatuses = []string{"successful", "failed", "canceled"}
+	pubSubSystems    = []string{"google", "amazon"}
+)
+
+// triggerCheck runs check against every trigger and prefixes the messages
+// with the position of the trigger in the pipeline config
+func triggerCheck(check func(t config.Trigger) (string, []string)) func(t *Target) []Finding {
+	return func(t *Target) []Finding {
+		var findings []Finding
+		for i, trigger := range t.Config.Triggers {
+			kind, msgs := check(trigger)
+			for _, msg := range msgs {
+				findings = append(findings, Finding{Message: fmt.Sprintf("trigger %d (%s): %s", i, kind, msg)})
+			}
+		}
+
+		return findings
+	}
+}
+
+func triggerGit(t config.Trigger) (string, []string) {
+	gt := t.Git
+	if gt == nil {
+		return "", nil
+	}
+
+	var msgs []string
+	if !contains(gitSources, gt.Source) {
+		msgs = append(msgs, fmt.Sprintf("source %q is not one of %s", gt.Source, strings.Join(gitSources, ", ")))
+	}
+	msgs = append(msgs, required(map[string]string{"project": gt.Project, "slug": gt.Slug})...)
+
+	return "git", msgs
+}
+
+func triggerCron(t config.Trigger) (string, []string) {
+	ct := t.Cron
+	if ct == nil {
+		return "", nil
+	}
+
+	var msgs []string
+	if err := parseCron(ct.Expression); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+	if ct.TimeZone != "" {
+		if _, err := time.LoadLocation(ct.TimeZone); err != nil {
+			msgs = append(msgs, fmt.Sprintf("timezone %q is not a known time zone", ct.TimeZone))
+		}
+	}
+
+	return "cron", msgs
+}
+
+func triggerPipeline(t config.Trigger) (string, []string) {
+	pt := t.Pipeline
+	if pt == nil {
+		return "", nil
+	}
+
+	msgs := required(map[string]string{"application": pt.Application, "pipeline": pt.Pipeline})
+	if len(pt.Status) == 0 {
+		msgs = append(msgs, fmt.Sprintf("status is empty, expected any of %s", strings.Join(pipelineStatuses, ", ")))
+	}
+	for _, s := range pt.Status {
+		if !contains(pipelineStatuses, s) {
+			msgs = append(msgs, fmt.Sprintf("status %q is not one of %s", s, strings.Join(pipelineStatuses, ", ")))
+		}
+	}
+
+	return "pipeline", msgs
+}
+
+func triggerPubSub(t config.Trigger) (string, []string) {
+	pt := t.PubSub
+	if pt == nil {
+		return "", nil
+	}
+
+	var msgs []string
+	if !contains(pubSubSystems, pt.System) {
+		msgs = append(msgs, fmt.Sprintf("system %q is not one of %s", pt.System, strings.Join(pubSubSystems, ", ")))
+	}
+	msgs = append(msgs, required(map[string]string{"subscription": pt.Subscription})...)
+
+	return "pubsub", msgs
+}
+
+// required reports the fields that are empty in order of their names
+func required(fields map[string]string) []string {
+	var names []string
+	for name, value := range fields {
+		if value == "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var msgs []string
+	for _, name := range names {
+		msgs = append(msgs, name+" is required")
+	}
+
+	return msgs
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,64 @@
+package validation_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/namely/k8s-pipeliner/pipeline/validation"
+)
+
+func triggerResults(t *testing.T, triggers ...config.Trigger) []string {
+	p := &config.Pipeline{Name: "Deploy", Application: "web", Triggers: triggers}
+
+	results, err := validation.New().Validate(p)
+	require.NoError(t, err)
+
+	var out []string
+	for _, r := range results {
+		out = append(out, r.String())
+	}
+
+	return out
+}
+
+func TestValidateTriggers(t *testing.T) {
+	t.Run("Valid triggers", func(t *testing.T) {
+		results := triggerResults(t,
+			config.Trigger{Git: &config.GitTrigger{Source: "github", Project: "namely", Slug: "web"}},
+			config.Trigger{Cron: &config.CronTrigger{Expression: "0 0 10 ? * MON-FRI", TimeZone: "America/New_York"}},
+			config.Trigger{Cron: &config.CronTrigger{Expression: "0 */15 9-17 L * ? 2030"}},
+			config.Trigger{Cron: &config.CronTrigger{Expression: "0 30 6 ? JAN,JUL 2#1"}},
+			config.Trigger{Pipeline: &config.PipelineTrigger{Application: "web", Pipeline: "0f2c4d6e", Status: []string{"successful", "failed"}}},
+			config.Trigger{PubSub: &config.PubSubTrigger{System: "google", Subscription: "deploys"}},
+		)
+
+		assert.Empty(t, results)
+	})
+
+	t.Run("Invalid triggers", func(t *testing.T) {
+		results := triggerResults(t,
+			config.Trigger{Git: &config.GitTrigger{Source: "svn", Project: "namely"}},
+			config.Trigger{Cron: &config.CronTrigger{Expression: "*/5 * * * *", TimeZone: "Mars/Olympus"}},
+			config.Trigger{Cron: &config.CronTrigger{Expression: "0 61 * * * ?"}},
+			config.Trigger{Cron: &config.CronTrigger{Expression: "0 0 10 * * MON"}},
+			config.Trigger{Pipeline: &config.PipelineTrigger{Application: "web", Status: []string{"succeeded"}}},
+			config.Trigger{PubSub: &config.PubSubTrigger{System: "kafka"}},
+		)
+
+		assert.Equal(t, []string{
+			`error: [trigger-git] trigger 0 (git): source "svn" is not one of github, gitlab, bitbucket, stash`,
+			`error: [trigger-git] trigger 0 (git): slug is required`,
+			`error: [trigger-cron] trigger 1 (cron): cron expression "*/5 * * * *" has 5 fields, expected 6 or 7 (seconds minutes hours day-of-month month day-of-week [year])`,
+			`error: [trigger-cron] trigger 1 (cron): timezone "Mars/Olympus" is not a known time zone`,
+			`error: [trigger-cron] trigger 2 (cron): cron expression "0 61 * * * ?" has an invalid minutes field: "61" is not a value between 0 and 59`,
+			`error: [trigger-cron] trigger 3 (cron): cron expression "0 0 10 * * MON" must set ? in exactly one of the day-of-month and day-of-week fields`,
+			`error: [trigger-pipeline] trigger 4 (pipeline): pipeline is required`,
+			`error: [trigger-pipeline] trigger 4 (pipeline): status "succeeded" is not one of successful, failed, canceled`,
+			`error: [trigger-pubsub] trigger 5 (pubsub): system "kafka" is not one of google, amazon`,
+			`error: [trigger-pubsub] trigger 5 (pubsub): subscription is required`,
+		}, results)
+	})
+}
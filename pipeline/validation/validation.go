@@ -0,0 +1,275 @@
+// Package validation runs named rules against a pipeline config and the
+// spinnaker pipeline built from it to catch mistakes before they are deployed.
+package validation
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder"
+	"github.com/namely/k8s-pipeliner/pipeline/builder/types"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+)
+
+// Severity describes how serious the findings of a rule are
+type Severity string
+
+const (
+	// SeverityError findings fail the validation
+	SeverityError Severity = "error"
+	// SeverityWarn findings are reported but do not fail the validation
+	SeverityWarn Severity = "warn"
+	// SeverityInfo findings are suggestions
+	SeverityInfo Severity = "info"
+)
+
+var (
+	// ErrUnknownRule is returned when the project config references a rule that does not exist
+	ErrUnknownRule = errors.New("validation: unknown rule")
+	// ErrUnknownSeverity is returned when a rule is configured with an invalid severity
+	ErrUnknownSeverity = errors.New("validation: unknown severity")
+	// ErrDuplicateRule is returned when two rules are registered with the same name
+	ErrDuplicateRule = errors.New("validation: duplicate rule")
+
+	severityOrder = map[Severity]int{SeverityError: 0, SeverityWarn: 1, SeverityInfo: 2}
+)
+
+// ParseSeverity converts a severity name from the project config
+func ParseSeverity(s string) (Severity, error) {
+	if _, ok := severityOrder[Severity(s)]; !ok {
+		return "", errors.Wrapf(ErrUnknownSeverity, "%q, expected one of error, warn or info", s)
+	}
+
+	return Severity(s), nil
+}
+
+// Target is everything a rule can inspect, the pipeline config and the
+// spinnaker pipeline that was built from it
+type Target struct {
+	Config    *config.Pipeline
+	Spinnaker *types.SpinnakerPipeline
+	Stages    []Stage
+
+	// Linear is set when the builder assigned the refIds of every stage in order
+	Linear bool
+	// Workloads are the kinds the builder finds the containers of embedded manifests in
+	Workloads builder.Workloads
+}
+
+// Stage pairs a stage from the pipeline config with the spinnaker stage built from it
+type Stage struct {
+	Config config.Stage
+	Built  types.Stage
+
+	Name  string
+	RefID string
+}
+
+// Finding is a single problem reported by a rule, Stage is nil for findings
+// about the whole pipeline
+type Finding struct {
+	Stage   *Stage
+	Message string
+}
+
+// Rule is a named check run by the validator
+type Rule struct {
+	Name        string
+	Description string
+	Severity    Severity
+	Check       func(t *Target) []Finding
+}
+
+// StageRule returns a rule that runs check against every stage of a pipeline
+// and reports the returned messages for the stage
+func StageRule(name, description string, severity Severity, check func(s Stage) []string) Rule {
+	return Rule{
+		Name:        name,
+		Description: description,
+		Severity:    severity,
+		Check: func(t *Target) []Finding {
+			var findings []Finding
+			for i := range t.Stages {
+				for _, msg := range check(t.Stages[i]) {
+					findings = append(findings, Finding{Stage: &t.Stages[i], Message: msg})
+				}
+			}
+			return findings
+		},
+	}
+}
+
+// Result is a finding of a rule with the severity it was reported with
+type Result struct {
+	Rule     string
+	Severity Severity
+	Stage    string
+	RefID    string
+	Message  string
+}
+
+func (r Result) String() string {
+	if r.Stage == "" && r.RefID == "" {
+		return fmt.Sprintf("%s: [%s] %s", r.Severity, r.Rule, r.Message)
+	}
+
+	return fmt.Sprintf("%s: stage %q (refId %s): [%s] %s", r.Severity, r.Stage, r.RefID, r.Rule, r.Message)
+}
+
+// Results are the findings of every rule of a validation
+type Results []Result
+
+// Count returns the amount of results with the given severity
+func (rs Results) Count(s Severity) int {
+	var n int
+	for _, r := range rs {
+		if r.Severity == s {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Err returns every error result as a multierror, or nil if there are none
+func (rs Results) Err() error {
+	var errs *multierror.Error
+	for _, r := range rs {
+		if r.Severity == SeverityError {
+			errs = multierror.Append(errs, errors.New(r.String()))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// Write prints every result on its own line
+func (rs Results) Write(w io.Writer) error {
+	for _, r := range rs {
+		if _, err := fmt.Fprintln(w, r.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validator runs a set of rules against pipelines
+type Validator struct {
+	rules          []Rule
+	ruleConfig     map[string]config.RuleConfig
+	builderOptions []builder.OptFunc
+}
+
+// New initializes a validator with the built in rules
+func New(opts ...OptFunc) *Validator {
+	v := &Validator{rules: DefaultRules()}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v
+}
+
+// Rules returns the enabled rules with their configured severity
+func (v *Validator) Rules() ([]Rule, error) {
+	known := make(map[string]bool)
+	for _, r := range v.rules {
+		if known[r.Name] {
+			return nil, errors.Wrap(ErrDuplicateRule, r.Name)
+		}
+		known[r.Name] = true
+	}
+
+	for name := range v.ruleConfig {
+		if !known[name] {
+			return nil, errors.Wrap(ErrUnknownRule, name)
+		}
+	}
+
+	var rules []Rule
+	for _, r := range v.rules {
+		cfg := v.ruleConfig[r.Name]
+		if cfg.Enabled != nil && !*cfg.Enabled {
+			continue
+		}
+
+		if cfg.Severity != "" {
+			sev, err := ParseSeverity(cfg.Severity)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rule %s", r.Name)
+			}
+			r.Severity = sev
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// Validate builds the pipeline and runs every enabled rule against it. The
+// error is only set when the pipeline can't be built or the rules are
+// misconfigured, rule findings are returned as results.
+func (v *Validator) Validate(p *config.Pipeline) (Results, error) {
+	rules, err := v.Rules()
+	if err != nil {
+		return nil, err
+	}
+
+	b := builder.New(p, v.builderOptions...)
+	sp, err := b.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Target{Config: p, Spinnaker: sp, Linear: b.IsLinear(), Workloads: b.Workloads()}
+	for i, built := range sp.Stages {
+		md := stageMetadata(built)
+		t.Stages = append(t.Stages, Stage{
+			Config: p.Stages[i],
+			Built:  built,
+			Name:   md.Name,
+			RefID:  md.RefID,
+		})
+	}
+
+	var results Results
+	for _, r := range rules {
+		for _, f := range r.Check(t) {
+			result := Result{Rule: r.Name, Severity: r.Severity, Message: f.Message}
+			if f.Stage != nil {
+				result.Stage = f.Stage.Name
+				result.RefID = f.Stage.RefID
+			}
+			results = append(results, result)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return severityOrder[results[i].Severity] < severityOrder[results[j].Severity]
+	})
+
+	return results, nil
+}
+
+// stageMetadata returns the metadata every spinnaker stage type embeds
+func stageMetadata(s types.Stage) types.StageMetadata {
+	v := reflect.Indirect(reflect.ValueOf(s))
+	if v.Kind() != reflect.Struct {
+		return types.StageMetadata{}
+	}
+
+	f := v.FieldByName("StageMetadata")
+	if !f.IsValid() {
+		return types.StageMetadata{}
+	}
+
+	md, _ := f.Interface().(types.StageMetadata)
+	return md
+}
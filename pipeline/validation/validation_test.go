@@ -0,0 +1,262 @@
+package validation_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/namely/k8s-pipeliner/pipeline/builder"
+	"github.com/namely/k8s-pipeliner/pipeline/config"
+	"github.com/namely/k8s-pipeliner/pipeline/validation"
+)
+
+func TestValidate(t *testing.T) {
+	p := loadPipeline(t)
+
+	results, err := validation.New(validation.WithBuilderOptions(builder.WithBasePath("testdata"))).Validate(p)
+	require.NoError(t, err)
+
+	assert.Equal(t, validation.Results{
+		{Rule: "manifest-resources", Severity: validation.SeverityError, Stage: "Deploy web", RefID: "deploy", Message: "Deployment web container web is missing cpu limits"},
+		{Rule: "manifest-resources", Severity: validation.SeverityError, Stage: "Deploy web", RefID: "deploy", Message: "Deployment web container web is missing memory limits"},
+		{Rule: "runjob-delete-job", Severity: validation.SeverityWarn, Stage: "Migrate", RefID: "migrate", Message: "deleteJob is not supported by the run job stage and has no effect"},
+		{Rule: "manifest-readiness-probe", Severity: validation.SeverityWarn, Stage: "Deploy web", RefID: "deploy", Message: "Deployment web container proxy has no readiness probe"},
+		{Rule: "manifest-image-tag", Severity: validation.SeverityWarn, Stage: "Deploy web", RefID: "deploy", Message: "Deployment web container web uses image registry.example.com:5000/web:latest without a pinned tag"},
+		{Rule: "manifest-namespace", Severity: validation.SeverityWarn, Stage: "Deploy web", RefID: "deploy", Message: "Service web has no namespace and is deployed to the default namespace of account int-k8s"},
+		{Rule: "runjob-service-account", Severity: validation.SeverityInfo, Stage: "Migrate", RefID: "migrate", Message: "no serviceAccountName is set, the job runs as the default service account of its namespace"},
+	}, results)
+
+	assert.Equal(t, 2, results.Count(validation.SeverityError))
+	require.Error(t, results.Err())
+	assert.Contains(t, results.Err().Error(), `error: stage "Deploy web" (refId deploy): [manifest-resources] Deployment web container web is missing cpu limits`)
+}
+
+func TestValidateDeployStages(t *testing.T) {
+	p := &config.Pipeline{
+		Name:        "Deploy web",
+		Application: "web",
+		Stages: []config.Stage{
+			{
+				Account: "int-k8s",
+				Name:    "Deploy",
+				Deploy: &config.DeployStage{
+					Groups: []config.Group{{ManifestFile: "web.yml"}},
+				},
+			},
+		},
+	}
+
+	results, err := validation.New(validation.WithBuilderOptions(builder.WithBasePath("testdata"), builder.WithLinear(true))).Validate(p)
+	require.NoError(t, err)
+
+	var messages []string
+	for _, r := range results {
+		if r.Rule == "deploy-resources" || r.Rule == "deploy-readiness-probe" {
+			assert.Equal(t, "0", r.RefID)
+			messages = append(messages, r.Message)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"container web is missing cpu limits",
+		"container web is missing memory limits",
+		"container proxy has no readiness probe",
+	}, messages)
+}
+
+func TestValidateRequiredArtifactImages(t *testing.T) {
+	p := loadPipeline(t)
+	p.ExpectedArtifacts = []config.ExpectedArtifact{
+		{ID: "web-image", Match: config.Artifact{Type: "docker/image", Name: "registry.example.com:5000/web"}},
+	}
+	p.Stages[1].DeployEmbeddedManifests.RequiredArtifactIDs = []string{"web-image"}
+
+	results, err := validation.New(validation.WithBuilderOptions(builder.WithBasePath("testdata"))).Validate(p)
+	require.NoError(t, err)
+
+	for _, r := range results {
+		assert.NotEqual(t, "manifest-image-tag", r.Rule, "images of required artifacts are replaced by spinnaker")
+	}
+}
+
+func TestValidateContainerOverrideResources(t *testing.T) {
+	p := loadPipeline(t)
+	p.Stages[1].DeployEmbeddedManifests.ContainerOverrides = []*config.ContainerOverrides{{
+		Name: "web",
+		Resources: &config.Resources{
+			Requests: &config.Resource{CPU: "250m", Memory: "256Mi"},
+			Limits:   &config.Resource{CPU: "1", Memory: "512Mi"},
+		},
+	}}
+
+	results, err := validation.New(validation.WithBuilderOptions(builder.WithBasePath("testdata"))).Validate(p)
+	require.NoError(t, err)
+
+	for _, r := range results {
+		assert.NotEqual(t, "manifest-resources", r.Rule, "resources set through container overrides count: %s", r.Message)
+	}
+}
+
+func TestValidateWorkloads(t *testing.T) {
+	p := &config.Pipeline{
+		Name:        "Deploy workers",
+		Application: "workers",
+		Stages: []config.Stage{
+			{
+				Account: "int-k8s",
+				Name:    "Deploy",
+				RefID:   "deploy",
+				DeployEmbeddedManifests: &config.DeployEmbeddedManifests{
+					Files: []config.ManifestFile{{File: "workers.yml"}},
+				},
+			},
+		},
+	}
+
+	project, err := config.NewProject(strings.NewReader(`
+workloads:
+  - group: workers.namely.com
+    kind: Worker
+    podSpecPath: spec.podTemplate.spec
+`))
+	require.NoError(t, err)
+
+	v := validation.New(validation.WithProject(project), validation.WithBuilderOptions(
+		builder.WithBasePath("testdata"),
+		builder.WithWorkloads(project.Workloads...),
+	))
+	results, err := v.Validate(p)
+	require.NoError(t, err)
+
+	var messages []string
+	for _, r := range results {
+		messages = append(messages, r.Message)
+	}
+
+	assert.Equal(t, []string{
+		"Worker compactor container compactor is missing cpu requests",
+		"Worker compactor container compactor is missing memory requests",
+		"Worker compactor container compactor is missing cpu limits",
+		"Worker compactor container compactor is missing memory limits",
+		"Rollout consumer container consumer has no readiness probe",
+		"Worker compactor container compactor uses image namely/compactor:latest without a pinned tag",
+	}, messages)
+}
+
+func TestValidateProjectConfig(t *testing.T) {
+	p := loadPipeline(t)
+
+	t.Run("Rules can be disabled and change severity", func(t *testing.T) {
+		project, err := config.NewProject(strings.NewReader(`
+validation:
+  rules:
+    manifest-resources:
+      severity: warn
+    runjob-service-account:
+      enabled: false
+    manifest-namespace:
+      enabled: false
+`))
+		require.NoError(t, err)
+
+		v := validation.New(validation.WithProject(project), validation.WithBuilderOptions(builder.WithBasePath("testdata")))
+		results, err := v.Validate(p)
+		require.NoError(t, err)
+
+		assert.NoError(t, results.Err())
+		assert.Equal(t, 0, results.Count(validation.SeverityInfo))
+		assert.Equal(t, 5, results.Count(validation.SeverityWarn))
+	})
+
+	t.Run("Unknown rules are rejected", func(t *testing.T) {
+		project := &config.Project{Validation: config.Validation{Rules: map[string]config.RuleConfig{"deploy-everything": {}}}}
+
+		_, err := validation.New(validation.WithProject(project)).Validate(p)
+		assert.Equal(t, validation.ErrUnknownRule, errors.Cause(err))
+	})
+
+	t.Run("Unknown severities are rejected", func(t *testing.T) {
+		project := &config.Project{Validation: config.Validation{Rules: map[string]config.RuleConfig{"deploy-resources": {Severity: "fatal"}}}}
+
+		_, err := validation.New(validation.WithProject(project)).Validate(p)
+		assert.Equal(t, validation.ErrUnknownSeverity, errors.Cause(err))
+	})
+
+	t.Run("Workloads need a kind and a pod spec path", func(t *testing.T) {
+		_, err := config.NewProject(strings.NewReader("workloads:\n  - group: workers.namely.com\n    kind: Worker\n"))
+		assert.Equal(t, config.ErrInvalidWorkload, errors.Cause(err))
+	})
+
+	t.Run("Environments need an env and one account pattern", func(t *testing.T) {
+		_, err := config.NewProject(strings.NewReader("environments:\n  accounts:\n    - account: int-*\n      regex: int-.*\n      env: int\n"))
+		assert.Equal(t, config.ErrInvalidEnvironment, errors.Cause(err))
+
+		_, err = config.NewProject(strings.NewReader("environments:\n  fallback: int\n"))
+		assert.Equal(t, config.ErrUnknownFallback, errors.Cause(err))
+
+		project, err := config.NewProject(strings.NewReader("environments:\n  accounts:\n    - regex: (int|qa)-k8s\n      env: int\n  fallback: error\n"))
+		require.NoError(t, err)
+		assert.Equal(t, config.FallbackError, project.Environments.Fallback)
+	})
+
+	t.Run("Project files are looked up in parent directories", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "project")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		nested := filepath.Join(dir, "services", "web")
+		require.NoError(t, os.MkdirAll(nested, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, config.ProjectFile), []byte("validation:\n  rules:\n    manifest-namespace:\n      enabled: false\n"), 0644))
+
+		project, err := config.LoadProject(nested)
+		require.NoError(t, err)
+		require.NotNil(t, project.Validation.Rules["manifest-namespace"].Enabled)
+		assert.False(t, *project.Validation.Rules["manifest-namespace"].Enabled)
+
+		empty, err := config.LoadProject(os.TempDir())
+		require.NoError(t, err)
+		assert.Empty(t, empty.Validation.Rules)
+	})
+}
+
+func TestValidateCustomRules(t *testing.T) {
+	p := loadPipeline(t)
+
+	rule := validation.Rule{
+		Name:     "pipeline-description",
+		Severity: validation.SeverityInfo,
+		Check: func(t *validation.Target) []validation.Finding {
+			if t.Config.Description != "" {
+				return nil
+			}
+			return []validation.Finding{{Message: "the pipeline has no description"}}
+		},
+	}
+
+	v := validation.New(validation.WithRules(rule), validation.WithBuilderOptions(builder.WithBasePath("testdata")))
+	results, err := v.Validate(p)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, results)
+	last := results[len(results)-1]
+	assert.Equal(t, "info: [pipeline-description] the pipeline has no description", last.String())
+
+	_, err = validation.New(validation.WithRules(validation.DefaultRules()[0])).Validate(p)
+	assert.Equal(t, validation.ErrDuplicateRule, errors.Cause(err))
+}
+
+func loadPipeline(t *testing.T) *config.Pipeline {
+	f, err := os.Open(filepath.Join("testdata", "pipeline.yml"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	p, err := config.NewPipeline(f, config.WithStrict(true))
+	require.NoError(t, err)
+
+	return p
+}